@@ -0,0 +1,127 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"golang.org/x/sys/unix"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/shell"
+)
+
+// terminal combines standard input and output
+type terminal struct {
+	io.Reader
+	io.Writer
+}
+
+// rawMode disables line buffering, echo and signal generation on a terminal,
+// output processing is retained.
+func rawMode(fd int) (restore func(), err error) {
+	termios, err := unix.IoctlGetTermios(fd, unix.TCGETS)
+
+	if err != nil {
+		return nil, errors.New("browse requires a terminal")
+	}
+
+	prev := *termios
+
+	termios.Iflag &^= unix.IGNBRK | unix.BRKINT | unix.PARMRK | unix.ISTRIP | unix.INLCR | unix.IGNCR | unix.ICRNL | unix.IXON
+	termios.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.ISIG | unix.IEXTEN
+	termios.Cflag &^= unix.CSIZE | unix.PARENB
+	termios.Cflag |= unix.CS8
+	termios.Cc[unix.VMIN] = 1
+	termios.Cc[unix.VTIME] = 0
+
+	if err = unix.IoctlSetTermios(fd, unix.TCSETS, termios); err != nil {
+		return
+	}
+
+	return func() { _ = unix.IoctlSetTermios(fd, unix.TCSETS, &prev) }, nil
+}
+
+// terminalSize returns the terminal size, falling back to the COLUMNS and
+// LINES environment variables (e.g. on serial consoles).
+func terminalSize(fd int) (columns int, lines int) {
+	if ws, err := unix.IoctlGetWinsize(fd, unix.TIOCGWINSZ); err == nil && ws.Col > 0 && ws.Row > 0 {
+		return int(ws.Col), int(ws.Row)
+	}
+
+	columns, _ = strconv.Atoi(os.Getenv("COLUMNS"))
+	lines, _ = strconv.Atoi(os.Getenv("LINES"))
+
+	return
+}
+
+func browse(f *fusemap.FuseMap) (err error) {
+	switch conf.base {
+	case 0, 2, 10, 16:
+	default:
+		return errors.New("you must specify a valid base format")
+	}
+
+	switch conf.endianness {
+	case "", "big", "little":
+	default:
+		return errors.New("you must specify a valid endianness")
+	}
+
+	s := &shell.Shell{
+		FuseMap:    f,
+		Read:       otpReader(f),
+		Base:       conf.base,
+		Endianness: conf.endianness,
+		Force:      conf.force,
+	}
+
+	if conf.critical != "" {
+		s.AllowCritical = strings.Split(conf.critical, ",")
+	}
+
+	// only signed manifests can be applied with a trust store
+	if conf.image == nil && conf.trusted == nil {
+		s.Blow = func(name string, val []byte) (err error) {
+			if err = checkDetected(f.Processor); err != nil {
+				return
+			}
+
+			res, addr, off, size, _, err := blowOTP(f, name, val)
+
+			if err != nil {
+				return
+			}
+
+			// stdout is reserved to the browser
+			if conf.syslog {
+				log.Printf("soc:%s ref:%s otp:%s op:blow addr:%#x off:%d len:%d val:%#x res:%#x", f.Processor, f.Reference, name, addr, off, size, val, res)
+			}
+
+			return
+		}
+	}
+
+	fd := int(os.Stdin.Fd())
+	s.Columns, s.Lines = terminalSize(fd)
+
+	restore, err := rawMode(fd)
+
+	if err != nil {
+		return
+	}
+	defer restore()
+
+	return s.Browse(&terminal{os.Stdin, os.Stdout})
+}
@@ -0,0 +1,198 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+	"text/tabwriter"
+)
+
+// command represents a crucible subcommand.
+type command struct {
+	// Name is the command name
+	Name string
+	// Args describes the command positional arguments
+	Args string
+	// Help is the command description
+	Help string
+	// Flags lists the command options (see addFlags())
+	Flags string
+}
+
+// globalFlags lists the options accepted before any command.
+const globalFlags = "YlsobendacjfimrtPCT"
+
+var commands = []*command{
+	{"list", "", "list available fusemaps", "f"},
+	{"devices", "", "list NVMEM devices", ""},
+	{"show", "[fuse/register name]", "visualize fusemap registers bit map, along with current values with -v", "mrfindavt"},
+	{"search", "[pattern]", "search fuses/registers by name, description or address", "mrfixkwp"},
+	{"browse", "", "full-screen fusemap browser, with current values and blow dialog", "mrfinacdbesjtYPCT"},
+	{"read", "<fuse/register name>", "read a fuse/register value", "mrfinadbesot"},
+	{"blow", "<fuse/register name> <value>", "blow a fuse/register value (DANGEROUS)", "mrfinacbesojtYPCT"},
+	{"check", "[fuse/register name]", "compare shadow registers against fuses (requires -a)", "mrfiac"},
+	{"reload", "", "reload shadow registers from fuses (requires -a)", "mrfiac"},
+	{"snapshot", "<path>", "save all OTP words to a JSON, YAML or raw snapshot", "mrfint"},
+	{"plan", "<manifest>", "compare manifest values against device ones", "mrfint"},
+	{"apply", "<manifest>", "blow manifest values (DANGEROUS)", "mrfinjstYPCTS"},
+	{"sign", "<manifest>", "sign a manifest with an Ed25519 private key", "KS"},
+	{"resume", "", "resume an interrupted fusing operation from the journal (DANGEROUS)", "njstYT"},
+	{"dump", "", "print all registers as an expected-state profile", "mrfinadot"},
+	{"verify", "<profile>", "verify device values against an expected-state profile", "mrfinadt"},
+	{"diff", "<dump file>", "compare all registers against a raw NVMEM dump file", "mrfinadt"},
+	{"completion", "<bash|zsh|fish>", "print shell completion script", ""},
+	{"help", "[command]", "show command help", ""},
+}
+
+// findCommand returns the command matching the argument name, nil is returned
+// if none is defined.
+func findCommand(name string) *command {
+	for _, c := range commands {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
+
+// addFlags defines the argument options, identified by their name, on a flag
+// set. All options are bound to the global configuration, with its current
+// values as default.
+func addFlags(fs *flag.FlagSet, names string) {
+	for _, name := range strings.Split(names, "") {
+		switch name {
+		case "Y":
+			fs.BoolVar(&conf.force, name, conf.force, "do not prompt for confirmation (DANGEROUS)")
+		case "l":
+			fs.BoolVar(&conf.list, name, conf.list, "list fusemaps\nvisualize fusemap      (with -m and -r)\nvisualize read value   (with read operation on a register)\nvisualize read fusemap (with read operation and no register)\n(deprecated, see list and show commands)")
+		case "v":
+			fs.BoolVar(&conf.values, name, conf.values, "visualize current values")
+		case "x":
+			fs.BoolVar(&conf.regexp, name, conf.regexp, "search pattern is a regular expression")
+		case "k":
+			fs.StringVar(&conf.keyword, name, conf.keyword, "search description keyword")
+		case "w":
+			fs.StringVar(&conf.address, name, conf.address, "search register read or write address")
+		case "p":
+			fs.IntVar(&conf.bit, name, conf.bit, "search bit position within register (with -w)")
+		case "s":
+			fs.BoolVar(&conf.syslog, name, conf.syslog, "use syslog, print only result value to stdout")
+		case "o":
+			fs.StringVar(&conf.output, name, conf.output, "output format (text,json)")
+		case "b":
+			fs.IntVar(&conf.base, name, conf.base, "value base/format (2,10,16)")
+		case "e":
+			fs.StringVar(&conf.endianness, name, conf.endianness, "value endianness (big,little)")
+		case "n":
+			fs.StringVar(&conf.device, name, conf.device, "NVMEM device name or path")
+		case "d":
+			fs.StringVar(&conf.offline, name, conf.offline, "NVMEM dump file, raw or snapshot, offline analysis (read-only)")
+		case "a":
+			fs.StringVar(&conf.controller, name, conf.controller, "OTP controller base address, direct register access through /dev/mem (DANGEROUS)")
+		case "c":
+			fs.Uint64Var(&conf.clock, name, conf.clock, "OTP controller clock (ipg_clk) rate in Hz, for direct register writes (default from clock tree)")
+		case "j":
+			fs.StringVar(&conf.journal, name, conf.journal, "fusing journal file")
+		case "P":
+			fs.StringVar(&conf.policy, name, conf.policy, "additional site policy file, marking critical fuses")
+		case "C":
+			fs.StringVar(&conf.critical, name, conf.critical, "comma separated critical fuse names allowed with -Y (DANGEROUS)")
+		case "T":
+			fs.StringVar(&conf.trust, name, conf.trust, "trusted manifest signing keys, PEM file or directory (enforces signed manifests)")
+		case "S":
+			fs.StringVar(&conf.signature, name, conf.signature, "manifest signature file (default <manifest>.sig)")
+		case "K":
+			fs.StringVar(&conf.key, name, conf.key, "manifest signing private key (PEM)")
+		case "f":
+			fs.StringVar(&conf.fusemaps, name, conf.fusemaps, "reference fusemap directory")
+		case "i":
+			fs.StringVar(&conf.fusemap, name, conf.fusemap, "overlay fusemap file")
+		case "m":
+			fs.StringVar(&conf.processor, name, conf.processor, "processor model")
+		case "r":
+			fs.StringVar(&conf.reference, name, conf.reference, "reference manual revision")
+		case "t":
+			fs.DurationVar(&conf.timeout, name, conf.timeout, "NVMEM device lock timeout")
+		}
+	}
+}
+
+// parseCommand parses the command options, if any, following the global ones.
+func parseCommand(args []string) []string {
+	if len(args) == 0 {
+		return args
+	}
+
+	c := findCommand(args[0])
+
+	if c == nil {
+		return args
+	}
+
+	fs := flag.NewFlagSet("crucible "+c.Name, flag.ExitOnError)
+	fs.SetOutput(flag.CommandLine.Output())
+	fs.Usage = func() { c.usage(fs) }
+
+	addFlags(fs, c.Flags)
+	_ = fs.Parse(args[1:])
+	fs.Visit(func(f *flag.Flag) { conf.explicit[f.Name] = true })
+
+	return append([]string{c.Name}, fs.Args()...)
+}
+
+func (c *command) usage(fs *flag.FlagSet) {
+	if conf.syslog {
+		return
+	}
+
+	log.Printf("Usage: crucible %s [options] %s\n\n%s\n", c.Name, c.Args, c.Help)
+
+	if fs != nil {
+		fs.PrintDefaults()
+	}
+}
+
+func commandsUsage() string {
+	var list bytes.Buffer
+
+	t := tabwriter.NewWriter(&list, 12, 8, 1, ' ', 0)
+
+	for _, c := range commands {
+		_, _ = fmt.Fprintf(t, "  %s\t%s\n", c.Name, c.Help)
+	}
+
+	_ = t.Flush()
+
+	return list.String()
+}
+
+// help prints the usage of a command, or of all commands when not specified.
+func help(name string) {
+	if name == "" {
+		flag.Usage()
+		return
+	}
+
+	c := findCommand(name)
+
+	if c == nil {
+		log.Fatalf("error: invalid command %s", name)
+	}
+
+	fs := flag.NewFlagSet("crucible "+c.Name, flag.ContinueOnError)
+	fs.SetOutput(flag.CommandLine.Output())
+	addFlags(fs, c.Flags)
+
+	c.usage(fs)
+}
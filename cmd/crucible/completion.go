@@ -0,0 +1,315 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/otp"
+)
+
+// Completion scripts invoke the hidden `__complete` command to retrieve
+// commands, options, processor models, references and fuse/register names
+// (from the fusemap selected with -m, or the detected SoC one).
+
+const bashCompletion = `# bash completion for crucible
+_crucible()
+{
+	local cur prev cmd m r i
+
+	cur="${COMP_WORDS[COMP_CWORD]}"
+	prev="${COMP_WORDS[COMP_CWORD-1]}"
+
+	for ((i = 1; i < COMP_CWORD; i++)); do
+		case "${COMP_WORDS[i]}" in
+		-m) m="${COMP_WORDS[++i]}" ;;
+		-r) r="${COMP_WORDS[++i]}" ;;
+		-Y|-l|-s|-v|-x) ;;
+		-*) ((i++)) ;;
+		*) [[ -z "$cmd" ]] && cmd="${COMP_WORDS[i]}" ;;
+		esac
+	done
+
+	case "$prev" in
+	-m) COMPREPLY=($(compgen -W "$(crucible __complete processors)" -- "$cur")); return ;;
+	-r) COMPREPLY=($(compgen -W "$(crucible __complete references "$m")" -- "$cur")); return ;;
+	-b) COMPREPLY=($(compgen -W "2 10 16" -- "$cur")); return ;;
+	-e) COMPREPLY=($(compgen -W "big little" -- "$cur")); return ;;
+	-o) COMPREPLY=($(compgen -W "text json" -- "$cur")); return ;;
+	-n) COMPREPLY=($(compgen -W "$(crucible __complete devices)" -f -- "$cur")); return ;;
+	-d|-f|-i|-j|-P|-T|-S|-K) COMPREPLY=($(compgen -f -- "$cur")); return ;;
+	-a|-c|-t|-k|-w|-p|-C) return ;;
+	esac
+
+	if [[ "$cur" == -* ]]; then
+		COMPREPLY=($(compgen -W "$(crucible __complete flags "$cmd")" -- "$cur"))
+		return
+	fi
+
+	case "$cmd" in
+	"") COMPREPLY=($(compgen -W "$(crucible __complete commands)" -- "$cur")) ;;
+	show|search|read|blow|check) COMPREPLY=($(compgen -W "$(crucible __complete names "$m" "$r")" -- "$cur")) ;;
+	completion) COMPREPLY=($(compgen -W "bash zsh fish" -- "$cur")) ;;
+	help) COMPREPLY=($(compgen -W "$(crucible __complete commands)" -- "$cur")) ;;
+	*) COMPREPLY=($(compgen -f -- "$cur")) ;;
+	esac
+}
+
+complete -F _crucible crucible
+`
+
+const zshCompletion = `#compdef crucible
+# zsh completion for crucible
+_crucible()
+{
+	local cmd m r i
+
+	for ((i = 2; i < CURRENT; i++)); do
+		case "${words[i]}" in
+		-m) m="${words[++i]}" ;;
+		-r) r="${words[++i]}" ;;
+		-Y|-l|-s|-v|-x) ;;
+		-*) ((i++)) ;;
+		*) [[ -z "$cmd" ]] && cmd="${words[i]}" ;;
+		esac
+	done
+
+	case "${words[CURRENT-1]}" in
+	-m) compadd -- ${(f)"$(crucible __complete processors)"}; return ;;
+	-r) compadd -- ${(f)"$(crucible __complete references "$m")"}; return ;;
+	-b) compadd 2 10 16; return ;;
+	-e) compadd big little; return ;;
+	-o) compadd text json; return ;;
+	-n) compadd -- ${(f)"$(crucible __complete devices)"}; _files; return ;;
+	-d|-f|-i|-j|-P|-T|-S|-K) _files; return ;;
+	-a|-c|-t|-k|-w|-p|-C) return ;;
+	esac
+
+	if [[ "${words[CURRENT]}" == -* ]]; then
+		compadd -- ${(f)"$(crucible __complete flags "$cmd")"}
+		return
+	fi
+
+	case "$cmd" in
+	"") compadd -- ${(f)"$(crucible __complete commands)"} ;;
+	show|search|read|blow|check) compadd -- ${(f)"$(crucible __complete names "$m" "$r")"} ;;
+	completion) compadd bash zsh fish ;;
+	help) compadd -- ${(f)"$(crucible __complete commands)"} ;;
+	*) _files ;;
+	esac
+}
+
+compdef _crucible crucible
+`
+
+const fishCompletion = `# fish completion for crucible
+function __crucible_command
+	set -l tokens (commandline -opc)
+	set -e tokens[1]
+
+	while set -q tokens[1]
+		switch $tokens[1]
+			case -Y -l -s -v -x
+			case '-*'
+				set -e tokens[1]
+			case '*'
+				echo $tokens[1]
+				return 0
+		end
+
+		set -e tokens[1]
+	end
+
+	return 1
+end
+
+function __crucible_option -a name
+	set -l tokens (commandline -opc)
+
+	for i in (seq 2 (math (count $tokens) - 1))
+		if test "$tokens[$i]" = "$name"
+			echo $tokens[(math $i + 1)]
+		end
+	end
+end
+
+complete -c crucible -f
+complete -c crucible -n 'not __crucible_command' -a '(crucible __complete commands)'
+complete -c crucible -n 'contains -- (__crucible_command) show search read blow check' -a '(crucible __complete names (__crucible_option -m) (__crucible_option -r))'
+complete -c crucible -n 'contains -- (__crucible_command) completion' -a 'bash zsh fish'
+complete -c crucible -n 'contains -- (__crucible_command) help' -a '(crucible __complete commands)'
+complete -c crucible -n 'contains -- (__crucible_command) snapshot plan apply sign verify diff' -F
+`
+
+// fishOptions returns the fish completion definitions for all options.
+func fishOptions() string {
+	var s strings.Builder
+
+	args := map[string]string{
+		"m": "-x -a '(crucible __complete processors)'",
+		"r": "-x -a '(crucible __complete references (__crucible_option -m))'",
+		"b": "-x -a '2 10 16'",
+		"e": "-x -a 'big little'",
+		"o": "-x -a 'text json'",
+		"n": "-r -a '(crucible __complete devices)'",
+		"d": "-r -F",
+		"f": "-r -F",
+		"i": "-r -F",
+		"j": "-r -F",
+		"P": "-r -F",
+		"T": "-r -F",
+		"S": "-r -F",
+		"K": "-r -F",
+		"C": "-x",
+		"a": "-x",
+		"c": "-x",
+		"t": "-x",
+		"k": "-x",
+		"w": "-x",
+		"p": "-x",
+	}
+
+	fs := flag.NewFlagSet("crucible", flag.ContinueOnError)
+	addFlags(fs, globalFlags+"vxkwpSK")
+
+	fs.VisitAll(func(f *flag.Flag) {
+		usage, _, _ := strings.Cut(f.Usage, "\n")
+		_, _ = fmt.Fprintf(&s, "complete -c crucible -s %s %s -d %q\n", f.Name, args[f.Name], usage)
+	})
+
+	return s.String()
+}
+
+// completion prints the completion script for the argument shell.
+func completion(shell string) (err error) {
+	switch shell {
+	case "bash":
+		fmt.Print(bashCompletion)
+	case "zsh":
+		fmt.Print(zshCompletion)
+	case "fish":
+		fmt.Print(fishCompletion)
+		fmt.Print(fishOptions())
+	default:
+		return fmt.Errorf("unsupported shell %q (bash,zsh,fish)", shell)
+	}
+
+	return
+}
+
+// fusemapList returns all fusemaps found in the fusemap directory.
+func fusemapList() (maps []*fusemap.FuseMap) {
+	_ = fs.WalkDir(conf.fusemapDir, ".", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || filepath.Ext(path) != ".yaml" {
+			return err
+		}
+
+		y, err := fs.ReadFile(conf.fusemapDir, path)
+
+		if err != nil {
+			return nil
+		}
+
+		if f, err := fusemap.Parse(y); err == nil {
+			maps = append(maps, f)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// complete prints completion candidates, one per line, for completion
+// scripts.
+func complete(args []string) {
+	var candidates []string
+
+	kind := ""
+
+	if len(args) > 0 {
+		kind = args[0]
+		args = args[1:]
+	}
+
+	param := func(i int) string {
+		if i < len(args) {
+			return args[i]
+		}
+
+		return ""
+	}
+
+	switch kind {
+	case "commands":
+		for _, c := range commands {
+			candidates = append(candidates, c.Name)
+		}
+	case "flags":
+		flags := globalFlags
+
+		if c := findCommand(param(0)); c != nil {
+			flags = c.Flags
+		}
+
+		for _, name := range strings.Split(flags, "") {
+			candidates = append(candidates, "-"+name)
+		}
+	case "processors":
+		for _, f := range fusemapList() {
+			candidates = append(candidates, f.Processor)
+		}
+	case "references":
+		for _, f := range fusemapList() {
+			if param(0) == "" || f.Processor == param(0) {
+				candidates = append(candidates, f.Reference)
+			}
+		}
+	case "devices":
+		devices, _ := otp.NVMEMDevices()
+
+		for _, d := range devices {
+			candidates = append(candidates, d.Name)
+		}
+	case "names":
+		processor := param(0)
+
+		if processor == "" {
+			if soc, err := otp.DetectSoC(conf.device); err == nil {
+				processor = soc.Processor
+			}
+		}
+
+		f, err := fusemap.FindProcessor(conf.fusemapDir, processor)
+
+		if err != nil || (param(1) != "" && param(1) != f.Reference) {
+			return
+		}
+
+		for _, reg := range f.Registers {
+			candidates = append(candidates, reg.Name)
+
+			for _, fuse := range reg.Fuses {
+				candidates = append(candidates, fuse.Name)
+			}
+		}
+	}
+
+	slices.Sort(candidates)
+
+	for _, c := range slices.Compact(candidates) {
+		fmt.Println(c)
+	}
+}
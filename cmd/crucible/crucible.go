@@ -13,27 +13,62 @@ import (
 	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
 	"log/syslog"
 	"os"
+	"slices"
+	"strings"
+	"time"
 
 	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/fusemaps"
+	"github.com/usbarmory/crucible/manifest"
+	"github.com/usbarmory/crucible/otp"
+	"github.com/usbarmory/crucible/profile"
 )
 
 type Config struct {
 	force      bool
 	list       bool
+	values     bool
+	regexp     bool
 	syslog     bool
+	output     string
 	base       int
 	endianness string
 	device     string
+	controller string
+	clock      uint64
+	offline    string
+	journal    string
+	policy     string
+	critical   string
+	trust      string
+	signature  string
+	key        string
 	fusemaps   string
 	fusemap    string
 	processor  string
 	reference  string
+	keyword    string
+	address    string
+	bit        int
+	timeout    time.Duration
+
+	ctrl    otp.Controller
+	image   io.ReaderAt
+	soc     *otp.SoC
+	socErr  error
+	trusted manifest.TrustStore
 
 	fusemapDir fs.FS
+
+	// explicitly set options
+	explicit map[string]bool
+
+	args []string
 }
 
 // build information, initialized at compile time (see Makefile)
@@ -42,6 +77,16 @@ var Build string
 
 var conf *Config
 
+// defaultPolicy is the site policy file, when present it is always applied
+// along with any additional one
+const defaultPolicy = "/etc/crucible/policy.yaml"
+
+// defaultTrustStore is the site trust store, when present only signed
+// manifests can be applied
+const defaultTrustStore = "/etc/crucible/trusted.pem"
+
+var stdin = bufio.NewReader(os.Stdin)
+
 const splash = `
  ▄████▄   ██▀███   █    ██  ▄████▄   ██▓ ▄▄▄▄    ██▓    ▓█████
 ▒██▀ ▀█  ▓██ ▒ ██▒ ██  ▓██▒▒██▀ ▀█  ▓██▒▓█████▄ ▓██▒    ▓█   ▀
@@ -57,22 +102,16 @@ const splash = `
                   Where SoCs meet their fate.
 `
 
-const warning = `
-████████████████████████████████████████████████████████████████████████████████
-
-                                **  WARNING  **
-
-Fusing SoC OTPs is an **irreversible** action that permanently fuses values on
-the device. This means that any errors in the process, or lost fused data such
-as cryptographic key material, might result in a **bricked** device.
-
-The use of this tool is therefore **at your own risk**.
-
-████████████████████████████████████████████████████████████████████████████████
-`
-
 func init() {
-	conf = &Config{}
+	conf = &Config{
+		explicit: make(map[string]bool),
+		output:   "text",
+		device:   "/sys/bus/nvmem/devices/imx-ocotp0/nvmem",
+		journal:  "/var/lib/crucible/journal",
+		trust:    defaultTrustStore,
+		bit:      -1,
+		timeout:  otp.LockTimeout,
+	}
 
 	log.SetFlags(0)
 	log.SetOutput(os.Stdout)
@@ -90,43 +129,119 @@ func init() {
 
 		log.Printf("crucible - One-Time-Programmable (OTP) fusing tool %s", tags)
 		log.Print(splash)
-		log.Printf("Usage: crucible [options] [read|blow] [fuse/register name] [value]\n")
+		log.Printf("Usage: crucible [options] <command> [command options] [arguments]\n\nCommands:\n%s\nRun 'crucible help <command>' for command options, global options:\n", commandsUsage())
 		flag.PrintDefaults()
 	}
 
-	flag.BoolVar(&conf.force, "Y", false, "do not prompt for confirmation (DANGEROUS)")
-	flag.BoolVar(&conf.list, "l", false, "list fusemaps\nvisualize fusemap      (with -m and -r)\nvisualize read value   (with read operation on a register)\nvisualize read fusemap (with read operation and no register)")
-	flag.BoolVar(&conf.syslog, "s", false, "use syslog, print only result value to stdout")
-	flag.IntVar(&conf.base, "b", 0, "value base/format (2,10,16)")
-	flag.StringVar(&conf.endianness, "e", "", "value endianness (big,little)")
-	flag.StringVar(&conf.device, "n", "/sys/bus/nvmem/devices/imx-ocotp0/nvmem", "NVMEM device")
-	flag.StringVar(&conf.fusemaps, "f", "", "reference fusemap directory")
-	flag.StringVar(&conf.fusemap, "i", "", "overlay fusemap file")
-	flag.StringVar(&conf.processor, "m", "", "processor model")
-	flag.StringVar(&conf.reference, "r", "", "reference manual revision")
+	addFlags(flag.CommandLine, globalFlags)
 
 	flag.Parse()
+	flag.Visit(func(f *flag.Flag) { conf.explicit[f.Name] = true })
+
+	conf.args = parseCommand(flag.Args())
+}
+
+// arg returns the i'th command line argument, following all options, an empty
+// string is returned if the argument does not exist.
+func arg(i int) string {
+	if i < 0 || i >= len(conf.args) {
+		return ""
+	}
+
+	return conf.args[i]
 }
 
 func confirm() bool {
-	reader := bufio.NewReader(os.Stdin)
 	log.Print("Would you really like to blow this fuse? Type YES all uppercase to confirm: ")
-	text, _ := reader.ReadString('\n')
+	text, _ := stdin.ReadString('\n')
 
 	return text == "YES\n"
 }
 
+// allowed returns whether all critical names are listed with -C.
+func allowed(critical []string) bool {
+	allow := strings.Split(conf.critical, ",")
+
+	for _, name := range critical {
+		if !slices.Contains(allow, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// confirmCritical requires an additional confirmation, repeating name and
+// value, before fusing critical registers or fuses. The -Y option applies only
+// when all involved critical names are listed with -C.
+func confirmCritical(tag string, f *fusemap.FuseMap, name string, val []byte) (err error) {
+	critical, err := f.Critical(name)
+
+	if err != nil || len(critical) == 0 {
+		return
+	}
+
+	if conf.force && allowed(critical) {
+		log.Printf("%s critical:%s result:allowed", tag, strings.Join(critical, ","))
+		return
+	}
+
+	confirmation := otp.CriticalConfirmation(name, val)
+
+	log.Print(otp.CriticalWarning)
+	log.Printf("%s critical:%s\n\n", tag, strings.Join(critical, ","))
+	log.Printf("Type %q to confirm: ", confirmation)
+
+	if text, _ := stdin.ReadString('\n'); strings.TrimSpace(text) != confirmation {
+		return errors.New("you are not ready...")
+	}
+
+	return
+}
+
 func checkArguments() error {
-	switch conf.base {
-	case 2, 10, 16:
+	switch conf.output {
+	case "text":
+	case "json":
+		switch arg(0) {
+		case "read", "blow", "dump":
+		default:
+			return errors.New("output format not supported for operation")
+		}
 	default:
-		return errors.New("you must specify a valid base format")
+		return errors.New("you must specify a valid output format")
+	}
+
+	switch arg(0) {
+	case "read", "blow":
+		// all bases are reported with JSON output
+		if arg(0) == "read" && conf.output == "json" {
+			break
+		}
+
+		switch conf.base {
+		case 2, 10, 16:
+		default:
+			return errors.New("you must specify a valid base format")
+		}
+	}
+
+	if arg(0) == "resume" {
+		return nil
 	}
 
 	if conf.device == "" {
 		return errors.New("you must specify the target NVMEM device")
 	}
 
+	if conf.processor == "" && conf.socErr != nil {
+		return fmt.Errorf("you must specify a processor model, could not detect SoC (%v)", conf.socErr)
+	}
+
+	if conf.processor == "" && conf.soc != nil && conf.soc.Processor == "" {
+		return fmt.Errorf("you must specify a processor model, ambiguous SoC detection (%s)", strings.Join(conf.soc.Candidates, ","))
+	}
+
 	if conf.processor == "" {
 		return errors.New("you must specify a processor model")
 	}
@@ -135,34 +250,156 @@ func checkArguments() error {
 		return errors.New("you must specify a reference manual revision")
 	}
 
-	if len(flag.Args()) < 2 {
-		return errors.New("missing arguments")
+	switch arg(0) {
+	case "check", "reload":
+		if conf.controller == "" {
+			return errors.New("operation requires direct register access (-a)")
+		}
+	case "dump", "show", "search", "browse":
+	default:
+		if len(conf.args) < 2 {
+			return errors.New("missing arguments")
+		}
 	}
 
 	return nil
 }
 
-func op(f *fusemap.FuseMap) {
+// detectSoC identifies the SoC of an NVMEM device, unsupported or ambiguous
+// SoCs leave the processor model to the user while conflicting detections are
+// retained to refuse fusing operations (see checkDetected).
+func detectSoC(devicePath string) {
+	conf.soc, conf.socErr = otp.DetectSoC(devicePath)
+
+	if errors.Is(conf.socErr, otp.ErrUnsupportedSoC) {
+		conf.socErr = nil
+	}
+}
+
+// checkDetected refuses fusing operations for a processor model which does
+// not match any of the detected SoC candidates, or when SoC detection failed.
+func checkDetected(processor string) error {
+	if conf.socErr != nil {
+		return fmt.Errorf("could not detect SoC, %v, refusing to blow", conf.socErr)
+	}
+
+	if conf.soc == nil || conf.soc.Matches(processor) {
+		return nil
+	}
+
+	return fmt.Errorf("processor model %s does not match detected SoC (%s), refusing to blow", processor, strings.Join(conf.soc.Candidates, ","))
+}
+
+func op(f *fusemap.FuseMap, m *manifest.Manifest, p *profile.Profile) {
 	if err := checkArguments(); err != nil {
-		flag.Usage()
+		if findCommand(arg(0)) != nil {
+			help(arg(0))
+		} else {
+			flag.Usage()
+		}
+
 		log.Fatalf("error: %v", err)
 	}
 
-	stat, err := os.Stat(conf.device)
+	if err := checkSigned(arg(0)); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	otp.LockTimeout = conf.timeout
 
-	if err != nil || stat.IsDir() {
-		log.Fatalf("error: could not open NVMEM device %s", conf.device)
+	switch {
+	case arg(0) == "search", arg(0) == "show" && !conf.values:
+		// fusemap only operations
+	case conf.image != nil:
+		switch arg(0) {
+		case "read", "show", "browse", "dump", "verify", "diff":
+		default:
+			log.Fatal("error: operation not supported in offline mode")
+		}
+	case conf.controller != "":
+		switch arg(0) {
+		case "read", "show", "browse", "blow", "check", "reload", "dump", "verify", "diff":
+		default:
+			log.Fatal("error: operation not supported with direct register access")
+		}
+
+		closer, err := openController(f)
+
+		if err != nil {
+			log.Fatalf("error: could not open OTP controller, %v", err)
+		}
+		defer closer()
+	case conf.device == "" && arg(0) == "resume":
+		// journal device, see resume()
+	default:
+		if stat, err := os.Stat(conf.device); err != nil || stat.IsDir() {
+			log.Fatalf("error: could not open NVMEM device %s", conf.device)
+		}
+
+		if f != nil {
+			if err := otp.CheckNVMEMDevice(conf.device, f); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+		}
 	}
 
-	op := flag.Arg(0)
-	name := flag.Arg(1)
+	var err error
+
+	op := arg(0)
+	name := arg(1)
 	tag := fmt.Sprintf("soc:%s ref:%s otp:%s op:%s", conf.processor, conf.reference, name, op)
 
 	switch op {
+	case "show":
+		err = show(f, name)
+	case "search":
+		err = search(f, name)
+	case "browse":
+		err = browse(f)
 	case "read":
 		err = read(tag, f, name)
+	case "check":
+		err = check(tag, f, name)
+	case "reload":
+		tag = fmt.Sprintf("soc:%s ref:%s op:%s", conf.processor, conf.reference, op)
+		err = reload(tag)
+	case "snapshot":
+		tag = fmt.Sprintf("soc:%s ref:%s op:%s path:%s", conf.processor, conf.reference, op, name)
+		err = snapshot(tag, f, name)
+	case "resume":
+		if conf.syslog && !conf.force {
+			log.Fatalf("error: forced operation is required when using syslog output")
+		}
+
+		err = resume(fmt.Sprintf("op:%s", op), f)
+	case "plan", "apply":
+		if conf.syslog && !conf.force && op == "apply" {
+			log.Fatalf("error: forced operation is required when using syslog output")
+		}
+
+		tag = fmt.Sprintf("soc:%s ref:%s op:%s", conf.processor, conf.reference, op)
+
+		if op == "apply" {
+			if err = checkDetected(conf.processor); err != nil {
+				break
+			}
+		}
+
+		if op == "plan" {
+			_, err = plan(tag, f, m)
+		} else {
+			err = apply(tag, f, m)
+		}
+	case "dump":
+		err = dump(f)
+	case "verify":
+		tag = fmt.Sprintf("soc:%s ref:%s op:%s", conf.processor, conf.reference, op)
+		err = verify(tag, f, p)
+	case "diff":
+		tag = fmt.Sprintf("soc:%s ref:%s op:%s path:%s", conf.processor, conf.reference, op, name)
+		err = diff(tag, f, name)
 	case "blow":
-		if len(flag.Args()) != 3 {
+		if len(conf.args) != 3 {
 			log.Fatal("error: missing arguments")
 		}
 
@@ -170,7 +407,11 @@ func op(f *fusemap.FuseMap) {
 			log.Fatalf("error: forced operation is required when using syslog output")
 		}
 
-		err = blow(tag, f, name, flag.Arg(2))
+		if err = checkDetected(conf.processor); err != nil {
+			break
+		}
+
+		err = blow(tag, f, name, arg(2))
 	default:
 		log.Fatal("error: invalid operation")
 	}
@@ -183,6 +424,8 @@ func op(f *fusemap.FuseMap) {
 func main() {
 	var f *fusemap.FuseMap
 	var v *fusemap.FuseMap
+	var m *manifest.Manifest
+	var p *profile.Profile
 	var err error
 
 	if conf.syslog {
@@ -191,10 +434,43 @@ func main() {
 		} else {
 			log.SetOutput(os.Stderr)
 		}
+	} else if conf.output == "json" {
+		log.SetOutput(os.Stderr)
 	} else {
 		log.SetOutput(os.Stdout)
 	}
 
+	conf.device = otp.NVMEMDevicePath(conf.device)
+
+	// resume operates on the journal device unless explicitly set
+	if arg(0) == "resume" && !conf.explicit["n"] {
+		conf.device = ""
+	}
+
+	switch arg(0) {
+	case "help":
+		help(arg(1))
+		return
+	case "completion":
+		if err = completion(arg(1)); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		return
+	case "devices":
+		listDevices()
+		return
+	case "sign":
+		if len(conf.args) < 2 {
+			help(arg(0))
+			log.Fatal("error: missing arguments")
+		}
+
+		if err = sign(fmt.Sprintf("op:sign path:%s", arg(1)), arg(1)); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+		return
+	}
+
 	if len(conf.fusemaps) > 0 {
 		stat, err := os.Stat(conf.fusemaps)
 
@@ -204,11 +480,16 @@ func main() {
 
 		conf.fusemapDir = os.DirFS(conf.fusemaps)
 	} else {
-		conf.fusemapDir, err = fs.Sub(fusemaps, "fusemaps")
+		conf.fusemapDir = fusemaps.FS
+	}
 
-		if err != nil {
-			log.Fatal("error: could not open fusemaps directory")
-		}
+	switch arg(0) {
+	case "list":
+		listFusemaps()
+		return
+	case "__complete":
+		complete(conf.args[1:])
+		return
 	}
 
 	if len(conf.fusemap) > 0 {
@@ -220,6 +501,73 @@ func main() {
 		conf.reference = v.Reference
 	}
 
+	if conf.trusted, err = openTrustStore(); err != nil {
+		log.Fatalf("error: %v", err)
+	}
+
+	switch arg(0) {
+	case "plan", "apply":
+		if len(conf.args) < 2 {
+			break
+		}
+
+		if conf.trusted != nil && arg(0) == "apply" {
+			m, err = manifest.OpenSigned(arg(1), signaturePath(arg(1)), conf.trusted)
+		} else {
+			m, err = manifest.Open(arg(1))
+		}
+
+		if err != nil {
+			log.Fatalf("error: could not open manifest, %v", err)
+		}
+
+		if conf.processor == "" && conf.reference == "" {
+			conf.processor = m.Processor
+			conf.reference = m.Reference
+		}
+	case "verify":
+		if len(conf.args) < 2 {
+			break
+		}
+
+		if p, err = profile.Open(arg(1)); err != nil {
+			log.Fatalf("error: could not open profile, %v", err)
+		}
+
+		if conf.processor == "" && conf.reference == "" {
+			conf.processor = p.Processor
+			conf.reference = p.Reference
+		}
+	}
+
+	var s *otp.Snapshot
+
+	if conf.offline != "" {
+		if s, err = otp.OpenSnapshot(conf.offline); err != nil {
+			log.Fatalf("error: could not open NVMEM dump file, %v", err)
+		}
+
+		if conf.processor == "" && conf.reference == "" {
+			conf.processor = s.Processor
+			conf.reference = s.Reference
+		}
+	}
+
+	if len(conf.args) > 0 && conf.offline == "" && conf.device != "" {
+		detectSoC(conf.device)
+	}
+
+	if conf.processor == "" && conf.reference == "" && conf.soc != nil && conf.soc.Processor != "" {
+		if f, err = fusemap.FindProcessor(conf.fusemapDir, conf.soc.Processor); err != nil {
+			log.Fatalf("error: could not open fusemap for detected SoC %s, %v", conf.soc.Processor, err)
+		}
+
+		conf.processor = f.Processor
+		conf.reference = f.Reference
+
+		log.Printf("soc:%s ref:%s id:%s op:detect", conf.processor, conf.reference, conf.soc.ID)
+	}
+
 	if conf.processor != "" && conf.reference != "" {
 		if f, err = fusemap.Find(conf.fusemapDir, conf.processor, conf.reference); err != nil {
 			log.Fatalf("error: could not open fusemap, %v", err)
@@ -232,9 +580,42 @@ func main() {
 		}
 	}
 
-	if conf.list && len(flag.Args()) < 2 {
+	for i, path := range []string{defaultPolicy, conf.policy} {
+		if f == nil || path == "" || (i > 0 && path == defaultPolicy) {
+			continue
+		}
+
+		policy, err := fusemap.OpenPolicy(path)
+
+		switch {
+		case errors.Is(err, fs.ErrNotExist) && i == 0:
+		case err != nil:
+			log.Fatalf("error: could not open policy, %v", err)
+		default:
+			if err = f.ApplyPolicy(policy); err != nil {
+				log.Fatalf("error: %v", err)
+			}
+		}
+	}
+
+	if conf.offline != "" {
+		if conf.controller != "" {
+			log.Fatal("error: offline analysis is not supported with direct register access")
+		}
+
+		if conf.image, err = snapshotImage(s, f); err != nil {
+			log.Fatalf("error: %v", err)
+		}
+	}
+
+	// legacy fusemap listing and visualization
+	if conf.list && len(conf.args) < 2 {
 		if conf.processor != "" && conf.reference != "" {
-			listFusemapRegisters(f)
+			conf.values = arg(0) == "read"
+
+			if err = show(f, ""); err != nil {
+				log.Fatalf("error: %v", err)
+			}
 		} else {
 			listFusemaps()
 		}
@@ -242,5 +623,5 @@ func main() {
 		return
 	}
 
-	op(f)
+	op(f, m, p)
 }
@@ -10,42 +10,134 @@ package main
 
 import (
 	"bytes"
-	"embed"
-	"flag"
+	"errors"
 	"fmt"
+	"io"
 	"io/fs"
 	"log"
-	"math/big"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"text/tabwriter"
 
 	"github.com/usbarmory/crucible/fusemap"
 	"github.com/usbarmory/crucible/otp"
 )
 
-// Bundled fusemaps
-//
-//go:embed fusemaps/*.yaml
-var fusemaps embed.FS
-
-func listFusemapRegisters(f *fusemap.FuseMap) {
+// show visualizes the bit map of a register, or of all fusemap registers when
+// not specified, along with their current value (with -v).
+func show(f *fusemap.FuseMap, name string) (err error) {
 	var res []byte
 
-	for _, reg := range f.RegistersByWriteAddress() {
-		if flag.Arg(0) == "read" {
-			res, _, _, _, err := otp.ReadNVMEM(conf.device, f, reg.Name)
+	regs := f.RegistersByWriteAddress()
 
-			if err != nil {
-				log.Fatalf("error: could not read fusemap, %v", err)
-			}
+	if name != "" {
+		mapping, err := f.Find(name)
 
-			n := new(big.Int)
-			n.SetBytes(res)
+		if err != nil {
+			return err
+		}
+
+		switch m := mapping.(type) {
+		case *fusemap.Register:
+			regs = []*fusemap.Register{m}
+		case *fusemap.Fuse:
+			regs = []*fusemap.Register{m.Register}
+		}
+	}
+
+	for _, reg := range regs {
+		if conf.values {
+			res, _, _, _, err = readOTP(f, reg.Name)
+
+			// skip registers beyond the device size (see fusemap.Gap)
+			if errors.Is(err, io.EOF) {
+				res = nil
+			} else if err != nil {
+				return fmt.Errorf("could not read fusemap, %v", err)
+			}
 		}
 
 		fmt.Print(reg.BitMap(res))
 		fmt.Println()
 	}
+
+	return nil
+}
+
+// search lists all registers and fuses matching the argument name pattern, the
+// description keyword (-k) and address/bit position (-w/-p).
+//
+// Name patterns are globs (see path.Match), matched as substrings when not
+// containing any wildcard, or regular expressions (-x), all case insensitive.
+func search(f *fusemap.FuseMap, pattern string) (err error) {
+	var list bytes.Buffer
+
+	q := &fusemap.Query{
+		Keyword: conf.keyword,
+	}
+
+	switch {
+	case pattern == "":
+	case conf.regexp:
+		q.Regexp = pattern
+	case strings.ContainsAny(pattern, "*?["):
+		q.Name = pattern
+	default:
+		q.Name = "*" + pattern + "*"
+	}
+
+	if conf.address != "" {
+		addr, err := strconv.ParseUint(conf.address, 0, 32)
+
+		if err != nil {
+			return fmt.Errorf("invalid address, %v", err)
+		}
+
+		q.Address = new(uint32)
+		*q.Address = uint32(addr)
+	}
+
+	if conf.bit >= 0 {
+		q.Bit = &conf.bit
+	}
+
+	if pattern == "" && q.Keyword == "" && q.Address == nil {
+		return errors.New("missing search pattern, keyword (-k) or address (-w)")
+	}
+
+	matches, err := f.Search(q)
+
+	if err != nil {
+		return
+	}
+
+	if len(matches) == 0 {
+		return errors.New("no fuse/register matching search criteria")
+	}
+
+	t := tabwriter.NewWriter(&list, 0, 8, 2, ' ', 0)
+	_, _ = fmt.Fprintf(t, "Name\tRegister\tBank\tWord\tAddress\tOffset\tLength\tDescription\n")
+
+	for _, m := range matches {
+		reg := m.Register
+		off := 0
+		length := reg.Length
+
+		if m.Fuse != nil {
+			reg = m.Fuse.Register
+			off = m.Fuse.Offset
+			length = m.Fuse.Length
+		}
+
+		_, _ = fmt.Fprintf(t, "%s\t%s\t%d\t%d\t%#x\t%d\t%d\t%s\n", m.Name(), reg.Name, reg.Bank, reg.Word, reg.WriteAddress, off, length, m.Description())
+	}
+
+	_ = t.Flush()
+
+	fmt.Print(list.String())
+
+	return
 }
 
 func listFusemaps() {
@@ -90,3 +182,31 @@ func listFusemaps() {
 
 	fmt.Print(list.String())
 }
+
+func listDevices() {
+	var list bytes.Buffer
+
+	devices, err := otp.NVMEMDevices()
+
+	if err != nil {
+		log.Fatalf("error: could not list NVMEM devices, %v", err)
+	}
+
+	t := tabwriter.NewWriter(&list, 16, 8, 0, '\t', tabwriter.TabIndent)
+
+	_, _ = fmt.Fprintf(t, "Name (-n)\tSize\tType\tRead-only\tDriver\n")
+
+	for _, d := range devices {
+		driver := d.Driver
+
+		if driver == "" {
+			driver = "-"
+		}
+
+		_, _ = fmt.Fprintf(t, "%s\t%d\t%s\t%v\t%s\n", d.Name, d.Size, d.Type, d.ReadOnly, driver)
+	}
+
+	_ = t.Flush()
+
+	fmt.Print(list.String())
+}
@@ -0,0 +1,200 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/manifest"
+	"github.com/usbarmory/crucible/otp"
+)
+
+func plan(tag string, f *fusemap.FuseMap, m *manifest.Manifest) (p []*manifest.Action, err error) {
+	if p, err = manifest.PlanNVMEM(conf.device, f, m); err != nil {
+		return
+	}
+
+	for _, a := range p {
+		action := "none"
+
+		switch {
+		case a.Conflict():
+			action = "conflict"
+		case a.Blow():
+			action = "blow"
+		}
+
+		log.Printf("%s otp:%s cur:%#x val:%#x lock:%v action:%s", tag, a.Entry.Name, a.Current, a.Value, a.Lock, action)
+	}
+
+	return
+}
+
+func apply(tag string, f *fusemap.FuseMap, m *manifest.Manifest) (err error) {
+	if conf.trusted != nil {
+		log.Printf("%s sig:%s result:authorized", tag, signaturePath(arg(1)))
+	}
+
+	p, err := plan(tag, f, m)
+
+	if err != nil {
+		return
+	}
+
+	blow := false
+
+	for _, a := range p {
+		if a.Conflict() {
+			return errors.New("manifest conflicts with fused values")
+		}
+
+		blow = blow || a.Blow()
+	}
+
+	if !blow {
+		log.Printf("%s result:unchanged", tag)
+		return
+	}
+
+	if !conf.force {
+		log.Print(otp.Warning)
+
+		if !confirm() {
+			log.Fatal("you are not ready...")
+		}
+	}
+
+	for _, a := range p {
+		if !a.Blow() {
+			continue
+		}
+
+		if err = confirmCritical(tag, f, a.Entry.Name, a.Value); err != nil {
+			return
+		}
+	}
+
+	j, err := openJournal()
+
+	if err != nil {
+		return
+	}
+	defer closeJournal(j)
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	if err = manifest.ApplyNVMEMContext(ctx, conf.device, f, p, j); err != nil {
+		logWriteError(tag, err)
+		return
+	}
+
+	log.Printf("%s result:verified", tag)
+
+	return
+}
+
+// signaturePath returns the detached signature file path of a manifest.
+func signaturePath(path string) string {
+	if conf.signature != "" {
+		return conf.signature
+	}
+
+	return path + manifest.SignatureExtension
+}
+
+// openTrustStore opens the trusted manifest signing keys, a nil trust store is
+// returned when not configured. The site trust store, when present, cannot be
+// overridden.
+func openTrustStore() (t manifest.TrustStore, err error) {
+	if conf.trust != defaultTrustStore {
+		if _, err := os.Stat(defaultTrustStore); err == nil {
+			return nil, fmt.Errorf("site trust store %s cannot be overridden", defaultTrustStore)
+		}
+	}
+
+	if conf.trust == "" {
+		return
+	}
+
+	t, err = manifest.OpenTrustStore(conf.trust)
+
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && conf.trust == defaultTrustStore:
+		return nil, nil
+	case err != nil:
+		return nil, fmt.Errorf("could not open trust store, %v", err)
+	}
+
+	return
+}
+
+// checkSigned refuses, when a trust store is configured, all fusing operations
+// other than the application of signed manifests against bundled fusemaps.
+func checkSigned(op string) error {
+	if conf.trusted == nil {
+		return nil
+	}
+
+	switch op {
+	case "blow":
+		return errors.New("only signed manifests can be applied, refusing to blow")
+	case "resume":
+		return errors.New("only signed manifests can be applied, apply the manifest again to complete interrupted operations")
+	case "apply":
+		if conf.fusemaps != "" || conf.fusemap != "" {
+			return errors.New("custom fusemaps are not allowed with signed manifests")
+		}
+	}
+
+	return nil
+}
+
+func sign(tag string, path string) (err error) {
+	if conf.key == "" {
+		return errors.New("you must specify a private key (-K)")
+	}
+
+	p, err := os.ReadFile(conf.key)
+
+	if err != nil {
+		return
+	}
+
+	key, err := manifest.ParsePrivateKey(p)
+
+	if err != nil {
+		return fmt.Errorf("could not open private key, %v", err)
+	}
+
+	y, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	if _, err = manifest.Parse(y); err != nil {
+		return fmt.Errorf("invalid manifest, %v", err)
+	}
+
+	sigPath := signaturePath(path)
+
+	if err = os.WriteFile(sigPath, manifest.Sign(y, key), 0644); err != nil {
+		return
+	}
+
+	log.Printf("%s sig:%s result:signed", tag, sigPath)
+
+	return
+}
@@ -9,11 +9,17 @@
 package main
 
 import (
+	"bytes"
+	"context"
 	"errors"
 	"fmt"
+	"io"
 	"log"
-	"math/big"
+	"os"
+	"os/signal"
+	"strconv"
 	"strings"
+	"syscall"
 
 	"github.com/usbarmory/crucible/fusemap"
 	"github.com/usbarmory/crucible/otp"
@@ -21,7 +27,38 @@ import (
 )
 
 func read(tag string, f *fusemap.FuseMap, name string) (err error) {
-	res, addr, off, size, err := otp.ReadNVMEM(conf.device, f, name)
+	var r *Result
+
+	if conf.output == "json" {
+		r = newResult(f, "read", name)
+		defer func() { r.setError(err); r.print() }()
+	}
+
+	if r != nil {
+		// the value is derived from the raw words to report a single read
+		words, addr, err := readWords(f, name)
+
+		if err != nil {
+			return err
+		}
+
+		res, _, size, err := otp.DecodeWords(f, name, words)
+
+		if err != nil {
+			return err
+		}
+
+		if conf.endianness == "little" {
+			res = util.SwitchEndianness(res)
+		}
+
+		r.Value = newValue(res, size)
+		r.setWords(f, addr, words)
+
+		return nil
+	}
+
+	res, addr, off, size, err := readOTP(f, name)
 
 	if err != nil {
 		return
@@ -33,26 +70,10 @@ func read(tag string, f *fusemap.FuseMap, name string) (err error) {
 		res = util.SwitchEndianness(res)
 	}
 
-	n := new(big.Int)
-	n.SetBytes(res)
-
-	var base string
-	var format string
-	var value string
+	base, value, err := formatValue(res, size, conf.base)
 
-	switch conf.base {
-	case 2:
-		base = "0b"
-		format = "%0" + fmt.Sprintf("%d", size) + "b"
-		value = fmt.Sprintf(format, n)
-	case 10:
-		value = fmt.Sprintf("%d", n)
-	case 16:
-		base = "0x"
-		format = "%0" + fmt.Sprintf("%d", (size+3)/4) + "x"
-		value = fmt.Sprintf(format, n)
-	default:
-		return errors.New("internal error, invalid base")
+	if err != nil {
+		return
 	}
 
 	log.Printf("%s val:%s%s", tag, base, value)
@@ -74,8 +95,14 @@ func read(tag string, f *fusemap.FuseMap, name string) (err error) {
 }
 
 func blow(tag string, f *fusemap.FuseMap, name string, val string) (err error) {
+	var r *Result
+
+	if conf.output == "json" {
+		r = newResult(f, "blow", name)
+		defer func() { r.setError(err); r.print() }()
+	}
+
 	base := ""
-	n := new(big.Int)
 
 	switch conf.base {
 	case 2:
@@ -87,41 +114,335 @@ func blow(tag string, f *fusemap.FuseMap, name string, val string) (err error) {
 		return errors.New("internal error, invalid base")
 	}
 
+	switch conf.endianness {
+	case "big", "little":
+	default:
+		return errors.New("you must specify a valid endianness")
+	}
+
 	val = strings.TrimPrefix(val, base)
-	n, ok := n.SetString(val, conf.base)
+	n, err := util.ParseValue(val, conf.base, conf.endianness)
 
-	if !ok {
+	if err != nil {
 		return errors.New("invalid value argument")
 	}
 
-	switch conf.endianness {
-	case "big":
-	case "little":
-		n = n.SetBytes(util.SwitchEndianness(n.Bytes()))
-	default:
-		return errors.New("you must specify a valid endianness")
+	if r != nil {
+		r.Value = newValue(n, r.Length)
 	}
 
 	if !conf.force {
-		log.Print(warning)
+		log.Print(otp.Warning)
 		log.Printf("%s reg:%s base:%d val:%s %s-endian\n\n", tag, name, conf.base, val, conf.endianness)
 
 		if !confirm() {
-			log.Fatal("you are not ready...")
+			return errors.New("you are not ready...")
 		}
 	}
 
-	res, addr, off, size, err := otp.BlowNVMEM(conf.device, f, name, n.Bytes())
+	if err = confirmCritical(tag, f, name, n); err != nil {
+		return
+	}
+
+	res, addr, off, size, words, err := blowOTP(f, name, n)
+
+	if r != nil {
+		r.setWritten(words)
+	}
 
 	if err != nil {
+		logWriteError(tag, err)
 		return err
 	}
 
 	log.Printf("%s addr:%#x off:%d len:%d val:%s%s res:%#x", tag, addr, off, size, base, val, res)
 
-	if conf.syslog {
+	if conf.syslog && r == nil {
 		fmt.Printf("%#x\n", res)
 	}
 
 	return
 }
+
+// blowOTP blows a register or fuse through the OTP controller, when selected,
+// or the NVMEM device, recording the operation in the fusing journal.
+func blowOTP(f *fusemap.FuseMap, name string, val []byte) (res []byte, addr uint32, off int, size int, words []otp.Word, err error) {
+	j, err := openJournal()
+
+	if err != nil {
+		return
+	}
+	defer closeJournal(j)
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	if conf.ctrl != nil {
+		return otp.BlowMMIOContext(ctx, conf.ctrl, f, name, val)
+	}
+
+	return j.BlowNVMEMContext(ctx, conf.device, f, name, val)
+}
+
+// openController selects direct register access to the OTP controller at the
+// configured base address, in place of the NVMEM device.
+func openController(f *fusemap.FuseMap) (closer func(), err error) {
+	base, err := strconv.ParseUint(conf.controller, 0, 32)
+
+	if err != nil {
+		return nil, errors.New("invalid base address")
+	}
+
+	size, err := otp.ControllerSize(f)
+
+	if err != nil {
+		return
+	}
+
+	mem, err := otp.OpenDevMem(uint32(base), size)
+
+	if err != nil {
+		return
+	}
+
+	if conf.ctrl, err = otp.NewController(f, mem); err != nil {
+		_ = mem.Close()
+		return
+	}
+
+	if ctrl, ok := conf.ctrl.(*otp.OCOTPController); ok && conf.clock != 0 {
+		ctrl.ClockRate = conf.clock
+	} else if ok {
+		rate, rateErr := otp.OCOTPClockRate()
+
+		// reads do not require the clock rate, writes are refused
+		// without it (see OCOTPController.BlowWord())
+		if rateErr != nil && arg(0) == "blow" {
+			_ = mem.Close()
+			return nil, fmt.Errorf("%v, specify the OTP controller clock rate (-c)", rateErr)
+		}
+
+		ctrl.ClockRate = rate
+	}
+
+	return func() { _ = mem.Close() }, nil
+}
+
+// readOTP reads a register or fuse from the NVMEM dump file or OTP controller,
+// when selected, or the NVMEM device.
+func readOTP(f *fusemap.FuseMap, name string) (res []byte, addr uint32, off int, size int, err error) {
+	if conf.image != nil {
+		return otp.ReadImage(conf.image, f, name)
+	}
+
+	if conf.ctrl != nil {
+		return otp.ReadMMIO(conf.ctrl, f, name)
+	}
+
+	return otp.ReadNVMEM(conf.device, f, name)
+}
+
+// readWords reads the raw OTP words covered by a register or fuse from the
+// NVMEM dump file or OTP controller, when selected, or the NVMEM device.
+func readWords(f *fusemap.FuseMap, name string) (words []byte, addr uint32, err error) {
+	if conf.image != nil {
+		return otp.ReadWordsImage(conf.image, f, name)
+	}
+
+	if conf.ctrl != nil {
+		return otp.ReadWordsMMIO(conf.ctrl, f, name)
+	}
+
+	return otp.ReadWordsNVMEM(conf.device, f, name)
+}
+
+func check(tag string, f *fusemap.FuseMap, name string) (err error) {
+	checks, err := otp.CheckMMIO(conf.ctrl, f, name)
+
+	if err != nil {
+		return
+	}
+
+	diverged := 0
+
+	for _, c := range checks {
+		result := "match"
+
+		if c.Diverged() {
+			result = "diverged"
+			diverged += 1
+		}
+
+		log.Printf("%s reg:%s index:%#x shadow:%#x fuse:%#x result:%s", tag, c.Name, c.Index, c.Shadow, c.Fuse, result)
+	}
+
+	if diverged > 0 {
+		return fmt.Errorf("%d shadow register(s) diverge from fuses, a shadow reload or reset is required", diverged)
+	}
+
+	return
+}
+
+func reload(tag string) (err error) {
+	if err = otp.ShadowReload(conf.ctrl); err != nil {
+		return
+	}
+
+	log.Printf("%s result:reloaded", tag)
+
+	return
+}
+
+func snapshot(tag string, f *fusemap.FuseMap, path string) (err error) {
+	s, err := otp.SnapshotNVMEM(conf.device, f)
+
+	if err != nil {
+		return
+	}
+
+	if err = s.Save(path); err != nil {
+		return
+	}
+
+	tag = fmt.Sprintf("%s format:%s len:%d", tag, otp.SnapshotFormat(path), len(s.Words))
+
+	if s.UniqueID != "" {
+		tag += " uid:" + s.UniqueID
+	}
+
+	log.Print(tag)
+
+	return
+}
+
+// snapshotImage returns the NVMEM image of a snapshot, refusing snapshots
+// taken with a different fusemap.
+func snapshotImage(s *otp.Snapshot, f *fusemap.FuseMap) (io.ReaderAt, error) {
+	if f != nil && s.Processor != "" && (s.Processor != f.Processor || s.Reference != f.Reference) {
+		return nil, fmt.Errorf("snapshot fusemap mismatch (%s %s != %s %s)", s.Processor, s.Reference, f.Processor, f.Reference)
+	}
+
+	return bytes.NewReader(s.Words), nil
+}
+
+// interruptible returns a context cancelled on SIGINT or SIGTERM, fusing
+// operations are interrupted between OTP word writes.
+func interruptible() (context.Context, context.CancelFunc) {
+	return signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+}
+
+func openJournal() (j *otp.Journal, err error) {
+	if conf.journal == "" {
+		return
+	}
+
+	if j, err = otp.OpenJournal(conf.journal); err != nil {
+		err = fmt.Errorf("could not open journal, %v", err)
+	}
+
+	return
+}
+
+func closeJournal(j *otp.Journal) {
+	if j != nil {
+		_ = j.Close()
+	}
+}
+
+func resume(tag string, f *fusemap.FuseMap) (err error) {
+	if conf.journal == "" {
+		return errors.New("you must specify a journal file")
+	}
+
+	records, err := otp.ReadJournal(conf.journal)
+
+	if err != nil {
+		return
+	}
+
+	pending, err := otp.Pending(records)
+
+	if err != nil {
+		return
+	}
+
+	if len(pending) == 0 {
+		log.Printf("%s result:none", tag)
+		return
+	}
+
+	op := pending[0]
+	device := conf.device
+
+	if device == "" {
+		device = op.Device
+		detectSoC(device)
+	}
+
+	if err = checkDetected(op.Processor); err != nil {
+		return
+	}
+
+	// the fusemap is required to refuse read-only and fused ECC words
+	if f == nil || f.Processor != op.Processor || f.Reference != op.Reference {
+		if f, err = fusemap.Find(conf.fusemapDir, op.Processor, op.Reference); err != nil {
+			return fmt.Errorf("could not open fusemap, %v", err)
+		}
+	}
+
+	if err = otp.CheckNVMEMDevice(device, f); err != nil {
+		return
+	}
+
+	tag = fmt.Sprintf("soc:%s ref:%s otp:%s %s", op.Processor, op.Reference, op.Name, tag)
+
+	log.Printf("%s addr:%#x res:%#x time:%s", tag, op.WriteAddress, op.Value, op.Time)
+
+	for _, r := range pending[1:] {
+		log.Printf("%s addr:%#x val:%#x journal:%s", tag, r.WriteAddress, r.Value, r.Op)
+	}
+
+	if !conf.force {
+		log.Print(otp.Warning)
+
+		if !confirm() {
+			return errors.New("you are not ready...")
+		}
+	}
+
+	j, err := openJournal()
+
+	if err != nil {
+		return
+	}
+	defer closeJournal(j)
+
+	ctx, stop := interruptible()
+	defer stop()
+
+	_, written, err := j.ResumeNVMEMContext(ctx, conf.device, f)
+
+	for _, addr := range written {
+		log.Printf("%s addr:%#x result:written", tag, addr)
+	}
+
+	if err != nil {
+		return
+	}
+
+	log.Printf("%s result:completed", tag)
+
+	return
+}
+
+func logWriteError(tag string, err error) {
+	var werr *otp.WriteError
+
+	if !errors.As(err, &werr) {
+		return
+	}
+
+	for _, w := range werr.Words {
+		log.Printf("%s addr:%#x val:%#x result:%s", tag, w.Address, w.Value, wordResult(w))
+	}
+}
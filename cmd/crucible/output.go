@@ -0,0 +1,194 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/otp"
+)
+
+// Result represents the outcome of a read or blow operation, emitted as a
+// single JSON object with `-o json`.
+type Result struct {
+	Processor    string        `json:"processor"`
+	Reference    string        `json:"reference"`
+	Op           string        `json:"op"`
+	Name         string        `json:"name"`
+	Register     string        `json:"register,omitempty"`
+	Bank         int           `json:"bank"`
+	Word         int           `json:"word"`
+	Index        int           `json:"index"`
+	ReadAddress  uint32        `json:"read_address"`
+	WriteAddress uint32        `json:"write_address"`
+	Offset       int           `json:"offset"`
+	Length       int           `json:"len"`
+	Words        []*ResultWord `json:"words,omitempty"`
+	Value        *Value        `json:"value,omitempty"`
+	Error        string        `json:"error,omitempty"`
+}
+
+// ResultWord represents a raw OTP word read or written by an operation.
+type ResultWord struct {
+	// Address is the NVMEM address, or the OTP word index with direct
+	// register access.
+	Address uint32 `json:"address"`
+	// Value is the raw word value (little-endian)
+	Value string `json:"value"`
+	// Result is the word write outcome (written, failed, skipped)
+	Result string `json:"result,omitempty"`
+}
+
+// Value represents an OTP value in all supported bases.
+type Value struct {
+	Binary      string `json:"bin"`
+	Decimal     string `json:"dec"`
+	Hexadecimal string `json:"hex"`
+}
+
+// formatValue returns a big-endian value of size bits, formatted in the
+// argument base, along with its prefix.
+func formatValue(val []byte, size int, base int) (prefix string, value string, err error) {
+	n := new(big.Int)
+	n.SetBytes(val)
+
+	switch base {
+	case 2:
+		prefix = "0b"
+		value = fmt.Sprintf("%0"+fmt.Sprintf("%d", size)+"b", n)
+	case 10:
+		value = fmt.Sprintf("%d", n)
+	case 16:
+		prefix = "0x"
+		value = fmt.Sprintf("%0"+fmt.Sprintf("%d", (size+3)/4)+"x", n)
+	default:
+		err = errors.New("internal error, invalid base")
+	}
+
+	return
+}
+
+func newValue(val []byte, size int) *Value {
+	v := &Value{}
+
+	for _, b := range []struct {
+		base  int
+		value *string
+	}{
+		{2, &v.Binary},
+		{10, &v.Decimal},
+		{16, &v.Hexadecimal},
+	} {
+		prefix, value, _ := formatValue(val, size, b.base)
+		*b.value = prefix + value
+	}
+
+	return v
+}
+
+// newResult returns the result of an operation on a register or fuse.
+func newResult(f *fusemap.FuseMap, op string, name string) (r *Result) {
+	r = &Result{
+		Processor: conf.processor,
+		Reference: conf.reference,
+		Op:        op,
+		Name:      name,
+	}
+
+	mapping, err := f.Find(name)
+
+	if err != nil {
+		return
+	}
+
+	var reg *fusemap.Register
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		reg = m
+		r.Length = reg.Length
+	case *fusemap.Fuse:
+		reg = m.Register
+		r.Offset = m.Offset
+		r.Length = m.Length
+	}
+
+	r.Register = reg.Name
+	r.Bank = reg.Bank
+	r.Word = reg.Word
+	r.Index = f.Index(reg)
+	r.ReadAddress = reg.ReadAddress
+	r.WriteAddress = reg.WriteAddress
+
+	return
+}
+
+// setWords sets the raw OTP words of a result, starting at the argument
+// address.
+func (r *Result) setWords(f *fusemap.FuseMap, addr uint32, words []byte) {
+	step := uint32(f.WordSize)
+
+	if conf.ctrl != nil {
+		step = 1
+	}
+
+	for i := 0; i+f.WordSize <= len(words); i += f.WordSize {
+		r.Words = append(r.Words, &ResultWord{
+			Address: addr + uint32(i/f.WordSize)*step,
+			Value:   fmt.Sprintf("%#x", words[i:i+f.WordSize]),
+		})
+	}
+}
+
+// wordResult returns the outcome of an OTP word write.
+func wordResult(w otp.Word) string {
+	switch {
+	case w.Err != nil:
+		return "failed"
+	case w.Written:
+		return "written"
+	default:
+		return "skipped"
+	}
+}
+
+// setWritten sets the OTP words of a result along with the outcome of each
+// word write, for both completed and failed fusing operations.
+func (r *Result) setWritten(words []otp.Word) {
+	for _, w := range words {
+		r.Words = append(r.Words, &ResultWord{
+			Address: w.Address,
+			Value:   fmt.Sprintf("%#x", w.Value),
+			Result:  wordResult(w),
+		})
+	}
+}
+
+// setError sets the error of a result.
+func (r *Result) setError(err error) {
+	if err != nil {
+		r.Error = err.Error()
+	}
+}
+
+// print emits the result to standard output as a JSON object.
+func (r *Result) print() {
+	buf, err := json.Marshal(r)
+
+	if err != nil {
+		return
+	}
+
+	_, _ = fmt.Fprintln(os.Stdout, string(buf))
+}
@@ -0,0 +1,161 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package main
+
+import (
+	"fmt"
+	"log"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/manifest"
+	"github.com/usbarmory/crucible/otp"
+	"github.com/usbarmory/crucible/profile"
+)
+
+// otpReader returns a reader for the OTP controller, when selected, or the
+// NVMEM device.
+func otpReader(f *fusemap.FuseMap) manifest.Reader {
+	return func(name string) (res []byte, err error) {
+		res, _, _, _, err = readOTP(f, name)
+		return
+	}
+}
+
+func dump(f *fusemap.FuseMap) (err error) {
+	p, err := profile.Dump(f, otpReader(f))
+
+	if err != nil {
+		return
+	}
+
+	var buf []byte
+
+	if conf.output == "json" {
+		buf, err = p.JSON()
+	} else {
+		buf, err = p.YAML()
+	}
+
+	if err != nil {
+		return
+	}
+
+	fmt.Print(string(buf))
+
+	if conf.output == "json" {
+		fmt.Println()
+	}
+
+	return
+}
+
+func verify(tag string, f *fusemap.FuseMap, p *profile.Profile) (err error) {
+	results, err := profile.Verify(f, p, otpReader(f))
+
+	if err != nil {
+		return
+	}
+
+	mismatches := 0
+
+	for _, r := range results {
+		result := "match"
+
+		switch {
+		case r.Entry.Ignore:
+			result = "ignored"
+		case !r.Match():
+			result = "mismatch"
+			mismatches += 1
+		}
+
+		log.Printf("%s otp:%s cur:%#x exp:%#x mask:%#x result:%s", tag, r.Entry.Name, r.Current, r.Value, r.Mask, result)
+	}
+
+	if mismatches > 0 {
+		return fmt.Errorf("%d fuse(s) do not match profile", mismatches)
+	}
+
+	log.Printf("%s result:pass", tag)
+
+	return
+}
+
+func diff(tag string, f *fusemap.FuseMap, path string) (err error) {
+	s, err := otp.OpenSnapshot(path)
+
+	if err != nil {
+		return
+	}
+
+	image, err := snapshotImage(s, f)
+
+	if err != nil {
+		return
+	}
+
+	cur, err := profile.Dump(f, otpReader(f))
+
+	if err != nil {
+		return
+	}
+
+	dump, err := profile.Dump(f, func(name string) (res []byte, err error) {
+		res, _, _, _, err = otp.ReadImage(image, f, name)
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	values := func(p *profile.Profile) map[string]manifest.Value {
+		v := make(map[string]manifest.Value)
+
+		for _, e := range p.Fuses {
+			v[e.Name] = e.Value
+		}
+
+		return v
+	}
+
+	curValues := values(cur)
+	dumpValues := values(dump)
+	differences := 0
+
+	// registers might be present only on either side (e.g. beyond the
+	// dump size), both are therefore walked
+	for _, reg := range f.RegistersByReadAddress() {
+		c, okCur := curValues[reg.Name]
+		d, okDump := dumpValues[reg.Name]
+
+		if okCur == okDump && c == d {
+			continue
+		}
+
+		if !okCur {
+			c = "-"
+		}
+
+		if !okDump {
+			d = "-"
+		}
+
+		log.Printf("%s otp:%s cur:%s dump:%s result:differ", tag, reg.Name, c, d)
+		differences += 1
+	}
+
+	if differences > 0 {
+		return fmt.Errorf("%d register(s) differ from dump file", differences)
+	}
+
+	log.Printf("%s result:identical", tag)
+
+	return
+}
@@ -12,17 +12,123 @@ import (
 	"errors"
 )
 
-func (f *FuseMap) driverParams() (wordSize int, err error) {
-	switch f.Driver {
-	case "nvmem-imx-iim":
-		wordSize = 1
-	case "nvmem-imx-ocotp":
-		wordSize = 4
-	case "":
-		err = errors.New("missing driver")
-	default:
-		err = errors.New("unsupported driver")
+// Driver represents the semantics of a Linux NVMEM OTP driver.
+type Driver struct {
+	// WordSize is the number of bytes per OTP word
+	WordSize int
+	// Writable indicates that the driver supports blow operations
+	Writable bool
+	// BitwiseWords is the number of lower OTP words which are bitwise
+	// programmable, all following words are word programmable and ECC
+	// protected (zero when the driver makes no such distinction)
+	BitwiseWords int
+	// WriteLock indicates that the driver permanently write locks word
+	// programmable OTP words once programmed (see BitwiseWords)
+	WriteLock bool
+	// WritableWords lists the OTP word index ranges (first and last word)
+	// which can be blown, all words are writable when empty
+	WritableWords [][2]int
+}
+
+// Drivers holds the supported NVMEM OTP drivers, indexed by fusemap driver
+// name.
+var Drivers = map[string]*Driver{
+	// i.MX5 IC Identification Module (IIM)
+	"nvmem-imx-iim": {
+		WordSize: 1,
+	},
+	// i.MX6, i.MX7, i.MX8M On-Chip OTP Controller (OCOTP)
+	"nvmem-imx-ocotp": {
+		WordSize: 4,
+		Writable: true,
+	},
+	// i.MX93 OCOTP through EdgeLock Enclave (ELE), fuse write requests
+	// are limited to SRK hash (128-135) and OEM (312-511) words, all
+	// other fuses (e.g. lifecycle, SRK revocation) require dedicated ELE
+	// commands
+	"nvmem-imx-ocotp-ele": {
+		WordSize:      4,
+		Writable:      true,
+		WritableWords: [][2]int{{128, 135}, {312, 511}},
+	},
+	// STM32MP15 Boot and Security OTP controller (BSEC)
+	"nvmem-stm32-romem": {
+		WordSize:     4,
+		Writable:     true,
+		BitwiseWords: 32,
+		WriteLock:    true,
+	},
+	// Allwinner Security ID (SID)
+	"nvmem-sunxi-sid": {
+		WordSize: 4,
+	},
+	// i.MX8QXP, i.MX8QM OCOTP through System Controller Firmware (SCFW)
+	"nvmem-imx-scu-ocotp": {
+		WordSize: 4,
+		Writable: true,
+	},
+}
+
+// LookupDriver returns the semantics of a supported NVMEM OTP driver.
+func LookupDriver(name string) (d *Driver, err error) {
+	if name == "" {
+		return nil, errors.New("missing driver")
+	}
+
+	d, ok := Drivers[name]
+
+	if !ok {
+		return nil, errors.New("unsupported driver")
 	}
 
 	return
 }
+
+func (f *FuseMap) driverParams() (wordSize int, err error) {
+	d, err := LookupDriver(f.Driver)
+
+	if err != nil {
+		return
+	}
+
+	return d.WordSize, nil
+}
+
+// driverECC returns whether the argument register is ECC protected due to
+// driver semantics (see Driver.BitwiseWords).
+func (f *FuseMap) driverECC(reg *Register) bool {
+	d, err := LookupDriver(f.Driver)
+	return err == nil && d.BitwiseWords > 0 && f.Index(reg) >= d.BitwiseWords
+}
+
+// WriteLocked returns whether the argument register is permanently write
+// locked, due to driver semantics (see Driver.WriteLock), once programmed.
+func (f *FuseMap) WriteLocked(reg *Register) bool {
+	d, err := LookupDriver(f.Driver)
+	return err == nil && d.WriteLock && f.driverECC(reg)
+}
+
+// Writable returns whether the fusemap driver supports blow operations.
+func (f *FuseMap) Writable() bool {
+	d, err := LookupDriver(f.Driver)
+	return err == nil && d.Writable
+}
+
+// WritableWord returns whether the argument OTP word index (see Index()) can
+// be blown according to the fusemap driver restrictions (see
+// Driver.WritableWords).
+func (f *FuseMap) WritableWord(index int) bool {
+	d, err := LookupDriver(f.Driver)
+
+	if err != nil || len(d.WritableWords) == 0 {
+		return true
+	}
+
+	for _, r := range d.WritableWords {
+		if index >= r[0] && index <= r[1] {
+			return true
+		}
+	}
+
+	return false
+}
@@ -22,12 +22,17 @@ type FuseMap struct {
 	Reference string               `json:"reference"`
 	Driver    string               `json:"driver"`
 	BankSize  int                  `json:"bank_size"`
+	UniqueID  string               `json:"unique_id"`
 	Registers map[string]*Register `json:"registers"`
 	Gaps      map[string]*Gap      `json:"gaps"`
 
 	WordSize int
 
 	valid bool
+	// address index, see At()
+	index map[uint32][]*Register
+	// word index, see At()
+	words map[int][]*Fuse
 }
 
 // Gap represents a gap definition to account for addressing gap between OTP
@@ -46,34 +51,73 @@ type Register struct {
 	Length       int
 	Bank         int              `json:"bank"`
 	Word         int              `json:"word"`
+	Address      *uint32          `json:"address"`
+	ECC          bool             `json:"ecc"`
+	ReadOnly     bool             `json:"read_only"`
+	Critical     bool             `json:"critical"`
+	Lock         bool             `json:"lock"`
+	Description  string           `json:"description"`
 	Fuses        map[string]*Fuse `json:"fuses"`
 }
 
 // Fuse is an OTP fuse definition, representing one or more bits within a
 // register.
 type Fuse struct {
-	Name     string
-	Offset   int `json:"offset"`
-	Length   int `json:"len"`
-	Register *Register
+	Name        string
+	Offset      int    `json:"offset"`
+	Length      int    `json:"len"`
+	Critical    bool   `json:"critical"`
+	Lock        bool   `json:"lock"`
+	Description string `json:"description"`
+	Register    *Register
 }
 
 // SetAddress sets register addressing.
+//
+// Registers with an explicit address are addressed at the corresponding
+// NVMEM device offset, their bank and word indices are informational only.
 func (f *FuseMap) SetAddress(reg *Register) (err error) {
 	if reg == nil {
 		return
 	}
 
-	if reg.Word >= f.BankSize {
+	if reg.Address != nil {
+		if int(*reg.Address)%f.WordSize != 0 {
+			return fmt.Errorf("register address must be aligned to %d bytes", f.WordSize)
+		}
+	} else if reg.Word >= f.BankSize {
 		return fmt.Errorf("register word cannot exceed %d", f.BankSize-1)
 	}
 
-	reg.ReadAddress = uint32((reg.Bank*f.BankSize + reg.Word) * f.WordSize)
+	reg.ReadAddress = uint32(f.Index(reg) * f.WordSize)
 	reg.WriteAddress = reg.ReadAddress
 
 	return
 }
 
+// Index returns the OTP word index of a register, computed as bank * bank size
+// + word or derived from its explicit address.
+func (f *FuseMap) Index(reg *Register) int {
+	switch {
+	case reg.Address == nil:
+		return reg.Bank*f.BankSize + reg.Word
+	default:
+		return int(*reg.Address) / f.WordSize
+	}
+}
+
+// RegisterAt returns the register defined at the argument OTP word index (see
+// Index()), nil is returned if none is defined.
+func (f *FuseMap) RegisterAt(index int) *Register {
+	for _, reg := range f.Registers {
+		if f.Index(reg) == index {
+			return reg
+		}
+	}
+
+	return nil
+}
+
 // ApplyGaps applies gap information to register addressing.
 func (f *FuseMap) ApplyGaps() (err error) {
 	raddr := make(map[string]uint32)
@@ -164,6 +208,10 @@ func (f *FuseMap) Validate() (err error) {
 			return
 		}
 
+		if f.driverECC(reg) {
+			reg.ECC = true
+		}
+
 		for n2, fuse := range reg.Fuses {
 			if _, ok := names[n2]; ok {
 				return fmt.Errorf("register/fuse names must be unique, double entry for %s", n2)
@@ -209,8 +257,16 @@ func (f *FuseMap) Validate() (err error) {
 		waddr[reg.WriteAddress] = true
 	}
 
+	f.buildIndex()
 	f.valid = true
 
+	if f.UniqueID != "" {
+		if _, err = f.Find(f.UniqueID); err != nil {
+			f.valid = false
+			return fmt.Errorf("invalid unique identifier, %v", err)
+		}
+	}
+
 	return
 }
 
@@ -266,6 +322,10 @@ func (f *FuseMap) Overlay(overlay *FuseMap) (err error) {
 				return fmt.Errorf("could not find reference register named %s", fuse.Register.Name)
 			}
 
+			if (fuse.Register.Address == nil) != (r.Address == nil) || f.Index(fuse.Register) != f.Index(r) {
+				return fmt.Errorf("overlay register %s address does not match reference address", r.Name)
+			}
+
 			if fuse.Register.Bank != r.Bank {
 				return fmt.Errorf("overlay register %s bank (%d) does not match reference bank (%d)", r.Name, fuse.Register.Bank, r.Bank)
 			}
@@ -10,6 +10,7 @@ package fusemap
 
 import (
 	"os"
+	"strings"
 	"testing"
 )
 
@@ -66,6 +67,143 @@ registers:
 	}
 }
 
+func TestDriverSemantics(t *testing.T) {
+	y := `
+---
+reference: test
+driver: nvmem-imx-scu-ocotp
+bank_size: 800
+registers:
+  NAME1:
+    bank: 0
+    word: 708
+    read_only: true
+...
+`
+
+	f, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.WordSize != 4 || !f.Writable() {
+		t.Error("unexpected nvmem-imx-scu-ocotp driver semantics")
+	}
+
+	if reg := f.Registers["NAME1"]; reg.ReadAddress != 708*4 || !reg.ReadOnly {
+		t.Errorf("unexpected register definition (%#x)", reg.ReadAddress)
+	}
+
+	f.Driver = "nvmem-imx-iim"
+
+	if f.Writable() {
+		t.Error("unexpected nvmem-imx-iim driver semantics")
+	}
+}
+
+func TestExplicitAddress(t *testing.T) {
+	y := `
+---
+reference: test
+driver: nvmem-imx-ocotp-ele
+bank_size: 8
+registers:
+  NAME1:
+    bank: 39
+    word: 3
+    address: 0x4ec
+  NAME2:
+    bank: 0
+    word: 1
+...
+`
+
+	f, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reg := f.Registers["NAME1"]; reg.ReadAddress != 0x4ec || f.Index(reg) != 315 || f.RegisterAt(315) != reg {
+		t.Errorf("unexpected explicit register addressing (%#x)", reg.ReadAddress)
+	}
+
+	if reg := f.Registers["NAME2"]; reg.ReadAddress != 0x04 || f.Index(reg) != 1 {
+		t.Errorf("unexpected register addressing (%#x)", reg.ReadAddress)
+	}
+
+	if !f.WritableWord(315) || f.WritableWord(1) {
+		t.Error("unexpected nvmem-imx-ocotp-ele writable words")
+	}
+
+	y = `
+---
+reference: test
+driver: nvmem-imx-ocotp-ele
+bank_size: 8
+registers:
+  NAME1:
+    address: 0x4ee
+...
+`
+
+	if _, err = Parse([]byte(y)); err == nil || err.Error() != "register address must be aligned to 4 bytes" {
+		t.Errorf("unaligned register address should raise an error (%v)", err)
+	}
+
+	y = `
+---
+reference: test
+driver: nvmem-imx-scu-ocotp
+bank_size: 800
+registers:
+  NAME1:
+    address: 0xb10
+...
+`
+
+	if f, err = Parse([]byte(y)); err != nil {
+		t.Fatal(err)
+	}
+
+	// byte offset of word 708
+	if reg := f.Registers["NAME1"]; reg.ReadAddress != 0xb10 || f.Index(reg) != 708 {
+		t.Errorf("unexpected explicit register addressing (%#x)", reg.ReadAddress)
+	}
+}
+
+func TestBitwiseWords(t *testing.T) {
+	y := `
+---
+reference: test
+driver: nvmem-stm32-romem
+bank_size: 32
+registers:
+  LOWER:
+    bank: 0
+    word: 31
+  UPPER:
+    bank: 1
+    word: 0
+...
+`
+
+	f, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if f.Registers["LOWER"].ECC || !f.Registers["UPPER"].ECC {
+		t.Error("only upper words should be ECC protected")
+	}
+
+	if f.WriteLocked(f.Registers["LOWER"]) || !f.WriteLocked(f.Registers["UPPER"]) {
+		t.Error("only upper words should be write locked once programmed")
+	}
+}
+
 func TestDuplicateRegisterName(t *testing.T) {
 	y := `
 ---
@@ -218,6 +356,35 @@ registers:
 	}
 }
 
+func TestUniqueID(t *testing.T) {
+	y := `
+---
+reference: test
+driver: nvmem-imx-ocotp
+bank_size: 8
+unique_id: UID
+registers:
+  REG1:
+    bank: 0
+    word: 0
+    fuses:
+      UID:
+        offset: 0
+        len: 64
+...
+`
+
+	if _, err := Parse([]byte(y)); err != nil {
+		t.Errorf("valid unique identifier should not raise an error (%v)", err)
+	}
+
+	y = strings.Replace(y, "unique_id: UID", "unique_id: SERIAL", 1)
+
+	if _, err := Parse([]byte(y)); err == nil {
+		t.Error("undefined unique identifier should raise an error")
+	}
+}
+
 func TestFind(t *testing.T) {
 	y := `
 ---
@@ -270,6 +437,42 @@ registers:
 	}
 }
 
+func TestRegisterAt(t *testing.T) {
+	y := `
+---
+reference: test
+driver: nvmem-imx-ocotp
+bank_size: 4
+registers:
+  REG1:
+    bank: 0
+    word: 0
+  REG2:
+    bank: 1
+    word: 1
+    ecc: true
+...
+`
+
+	f, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if reg := f.RegisterAt(5); reg == nil || reg.Name != "REG2" || !reg.ECC {
+		t.Error("register lookup by index should return the matching register")
+	}
+
+	if reg := f.RegisterAt(0); reg == nil || reg.ECC {
+		t.Error("registers should not be ECC protected by default")
+	}
+
+	if reg := f.RegisterAt(1); reg != nil {
+		t.Error("register lookup on undefined index should return nil")
+	}
+}
+
 func TestInvalidGap(t *testing.T) {
 	y := `
 ---
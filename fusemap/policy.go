@@ -0,0 +1,141 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package fusemap
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+)
+
+// Policy represents a site policy marking registers and fuses as critical, in
+// addition to fusemap definitions.
+type Policy struct {
+	Critical []*PolicyEntry `json:"critical"`
+}
+
+// PolicyEntry represents a critical register or fuse definition.
+type PolicyEntry struct {
+	// Name is the register or fuse name
+	Name string `json:"name"`
+	// Processor is the processor model, the entry applies to all models
+	// when not set.
+	Processor string `json:"processor"`
+}
+
+// ParsePolicy converts a policy YAML payload to a Policy structure.
+func ParsePolicy(y []byte) (p *Policy, err error) {
+	p = &Policy{}
+
+	if err = yaml.Unmarshal(y, p); err != nil {
+		return
+	}
+
+	for _, e := range p.Critical {
+		if e == nil || e.Name == "" {
+			return nil, errors.New("missing critical entry name")
+		}
+	}
+
+	return
+}
+
+// OpenPolicy parses a policy YAML file and converts it to a Policy structure.
+func OpenPolicy(path string) (p *Policy, err error) {
+	y, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	return ParsePolicy(y)
+}
+
+// ApplyPolicy marks policy entries as critical registers or fuses. Entries not
+// found in the fusemap are ignored, unless their processor model matches the
+// fusemap one, as policies can apply to multiple processor models.
+func (f *FuseMap) ApplyPolicy(p *Policy) (err error) {
+	if p == nil {
+		return
+	}
+
+	for _, e := range p.Critical {
+		if e.Processor != "" && e.Processor != f.Processor {
+			continue
+		}
+
+		mapping, err := f.Find(e.Name)
+
+		switch {
+		case err != nil && e.Processor != "":
+			return fmt.Errorf("invalid policy, %v", err)
+		case err != nil:
+			continue
+		}
+
+		switch m := mapping.(type) {
+		case *Register:
+			m.Critical = true
+		case *Fuse:
+			m.Critical = true
+		}
+	}
+
+	return
+}
+
+// bits returns the OTP bit range, starting from the first register word, of a
+// register or fuse.
+func (f *FuseMap) bits(reg *Register, off int, length int) (start int, end int) {
+	start = f.Index(reg)*reg.Length + off
+	return start, start + length
+}
+
+// Critical returns the names of all critical registers and fuses overlapping
+// with the bits of the argument register or fuse, in write address and offset
+// order.
+//
+// Blowing a register therefore always involves the critical fuses it contains,
+// while blowing a fuse involves critical aliases sharing any of its bits.
+func (f *FuseMap) Critical(name string) (names []string, err error) {
+	var start, end int
+
+	mapping, err := f.Find(name)
+
+	if err != nil {
+		return
+	}
+
+	switch m := mapping.(type) {
+	case *Register:
+		start, end = f.bits(m, 0, m.Length)
+	case *Fuse:
+		start, end = f.bits(m.Register, m.Offset, m.Length)
+	}
+
+	overlaps := func(s int, e int) bool {
+		return s < end && start < e
+	}
+
+	for _, reg := range f.RegistersByWriteAddress() {
+		if reg.Critical && overlaps(f.bits(reg, 0, reg.Length)) {
+			names = append(names, reg.Name)
+		}
+
+		for _, fuse := range reg.FusesByOffset() {
+			if fuse.Critical && overlaps(f.bits(reg, fuse.Offset, fuse.Length)) {
+				names = append(names, fuse.Name)
+			}
+		}
+	}
+
+	return
+}
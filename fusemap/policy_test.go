@@ -0,0 +1,124 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package fusemap
+
+import (
+	"slices"
+	"testing"
+)
+
+const policyMap = `
+---
+processor: TEST
+reference: test
+driver: nvmem-imx-ocotp
+bank_size: 8
+registers:
+  REG1:
+    bank: 0
+    word: 0
+    fuses:
+      SEC_CONFIG:
+        offset: 0
+        len: 2
+        critical: true
+      SEC_CONFIG[1]:
+        offset: 1
+        len: 1
+      BOOT_CFG:
+        offset: 8
+        len: 8
+  REG2:
+    bank: 0
+    word: 1
+    fuses:
+      SRK_HASH:
+        offset: 16
+        len: 32
+  REG3:
+    bank: 0
+    word: 2
+    fuses:
+      SRK_LOCK:
+        offset: 0
+        len: 1
+`
+
+func TestCritical(t *testing.T) {
+	f, err := Parse([]byte(policyMap))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ParsePolicy([]byte(`
+critical:
+  - name: SRK_LOCK
+  - name: REG2
+    processor: OTHER
+  - name: OTHER_LOCK
+`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.ApplyPolicy(p); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string][]string{
+		"REG1":          {"SEC_CONFIG"},
+		"SEC_CONFIG":    {"SEC_CONFIG"},
+		"SEC_CONFIG[1]": {"SEC_CONFIG"},
+		"BOOT_CFG":      nil,
+		"REG2":          nil,
+		// fuse spanning into the following register
+		"SRK_HASH": {"SRK_LOCK"},
+		"REG3":     {"SRK_LOCK"},
+	}
+
+	for name, exp := range tests {
+		critical, err := f.Critical(name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(critical, exp) {
+			t.Errorf("unexpected critical fuses for %s, %v != %v", name, critical, exp)
+		}
+	}
+
+	if _, err := f.Critical("INVALID"); err == nil {
+		t.Error("invalid name should raise an error")
+	}
+}
+
+func TestInvalidPolicy(t *testing.T) {
+	f, err := Parse([]byte(policyMap))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParsePolicy([]byte("critical:\n  - processor: TEST\n")); err == nil {
+		t.Error("policy entry without name should raise an error")
+	}
+
+	p, err := ParsePolicy([]byte("critical:\n  - name: OTHER_LOCK\n    processor: TEST\n"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = f.ApplyPolicy(p); err == nil {
+		t.Error("policy entry not found for matching processor should raise an error")
+	}
+}
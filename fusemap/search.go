@@ -0,0 +1,213 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package fusemap
+
+import (
+	"errors"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Match represents a fusemap search result, Fuse is nil for register matches.
+type Match struct {
+	// Register is the matching register, or the one at the searched
+	// address for fuses spanning multiple words.
+	Register *Register
+	// Fuse is the matching fuse
+	Fuse *Fuse
+}
+
+// Name returns the matching register or fuse name.
+func (m *Match) Name() string {
+	if m.Fuse != nil {
+		return m.Fuse.Name
+	}
+
+	return m.Register.Name
+}
+
+// Description returns the matching register or fuse description.
+func (m *Match) Description() string {
+	if m.Fuse != nil {
+		return m.Fuse.Description
+	}
+
+	return m.Register.Description
+}
+
+// Query represents fusemap search criteria, all specified criteria must
+// match.
+type Query struct {
+	// Name matches names against a glob pattern (see path.Match), case
+	// insensitive.
+	Name string
+	// Regexp matches names against a regular expression, case insensitive.
+	Regexp string
+	// Keyword matches descriptions containing it, case insensitive.
+	Keyword string
+	// Address matches registers at a read or write address, along with
+	// the fuses covering it (see At()).
+	Address *uint32
+	// Bit restricts address matches to fuses covering a bit position within
+	// the register word (requires Address).
+	Bit *int
+}
+
+// buildIndex populates the reverse index used to look up registers by
+// address and fuses by covered word.
+func (f *FuseMap) buildIndex() {
+	f.index = make(map[uint32][]*Register)
+	f.words = make(map[int][]*Fuse)
+
+	for _, reg := range f.Registers {
+		if reg == nil {
+			continue
+		}
+
+		f.index[reg.ReadAddress] = append(f.index[reg.ReadAddress], reg)
+
+		if reg.WriteAddress != reg.ReadAddress {
+			f.index[reg.WriteAddress] = append(f.index[reg.WriteAddress], reg)
+		}
+
+		i := f.Index(reg)
+
+		for _, fuse := range reg.Fuses {
+			if fuse == nil || fuse.Length <= 0 {
+				continue
+			}
+
+			first := i + fuse.Offset/reg.Length
+			last := i + (fuse.Offset+fuse.Length-1)/reg.Length
+
+			for w := first; w <= last; w++ {
+				f.words[w] = append(f.words[w], fuse)
+			}
+		}
+	}
+
+	for _, regs := range f.index {
+		sort.Sort(regsByReadAddress(regs))
+	}
+
+	for _, fuses := range f.words {
+		sort.SliceStable(fuses, func(i, j int) bool {
+			a := f.Index(fuses[i].Register)
+			b := f.Index(fuses[j].Register)
+
+			if a != b {
+				return a < b
+			}
+
+			return fusesByOffset(fuses).Less(i, j)
+		})
+	}
+}
+
+// At returns the register defined at the argument read or write address,
+// followed by all fuses covering the argument bit position within it, or
+// covering any of its bits when the position is negative.
+//
+// Fuses exceeding their register word length are reported for every
+// register word they cover.
+func (f *FuseMap) At(address uint32, bit int) (matches []*Match) {
+	for _, reg := range f.index[address] {
+		i := f.Index(reg)
+
+		matches = append(matches, &Match{Register: reg})
+
+		for _, fuse := range f.words[i] {
+			// bit offset of the register word within the fuse one
+			off := (i - f.Index(fuse.Register)) * reg.Length
+
+			if bit >= 0 && (off+bit < fuse.Offset || off+bit >= fuse.Offset+fuse.Length) {
+				continue
+			}
+
+			matches = append(matches, &Match{Register: reg, Fuse: fuse})
+		}
+	}
+
+	return
+}
+
+// Search returns all registers and fuses matching the argument query, in
+// write address and fuse offset order.
+func (f *FuseMap) Search(q *Query) (matches []*Match, err error) {
+	var re *regexp.Regexp
+
+	if !f.valid {
+		return nil, errors.New("fusemap has not been validated yet")
+	}
+
+	if q.Name != "" {
+		if _, err = path.Match(q.Name, ""); err != nil {
+			return
+		}
+	}
+
+	if q.Regexp != "" {
+		if re, err = regexp.Compile("(?i)" + q.Regexp); err != nil {
+			return
+		}
+	}
+
+	if q.Bit != nil {
+		if q.Address == nil {
+			return nil, errors.New("bit position requires an address")
+		}
+
+		if *q.Bit < 0 {
+			return nil, errors.New("invalid bit position")
+		}
+	}
+
+	var candidates []*Match
+
+	switch {
+	case q.Address != nil && q.Bit != nil:
+		candidates = f.At(*q.Address, *q.Bit)
+	case q.Address != nil:
+		candidates = f.At(*q.Address, -1)
+	default:
+		for _, reg := range f.RegistersByWriteAddress() {
+			candidates = append(candidates, &Match{Register: reg})
+
+			for _, fuse := range reg.FusesByOffset() {
+				candidates = append(candidates, &Match{Register: reg, Fuse: fuse})
+			}
+		}
+	}
+
+	keyword := strings.ToLower(q.Keyword)
+
+	for _, m := range candidates {
+		name := m.Name()
+
+		if q.Name != "" {
+			if ok, _ := path.Match(strings.ToUpper(q.Name), strings.ToUpper(name)); !ok {
+				continue
+			}
+		}
+
+		if re != nil && !re.MatchString(name) {
+			continue
+		}
+
+		if keyword != "" && !strings.Contains(strings.ToLower(m.Description()), keyword) {
+			continue
+		}
+
+		matches = append(matches, m)
+	}
+
+	return
+}
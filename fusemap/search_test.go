@@ -0,0 +1,141 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package fusemap
+
+import (
+	"slices"
+	"testing"
+)
+
+const searchMap = `
+---
+reference: test
+driver: nvmem-imx-ocotp
+bank_size: 8
+gaps:
+  REG3:
+    read: true
+    len: 8
+registers:
+  REG1:
+    bank: 0
+    word: 0
+    description: boot configuration
+    fuses:
+      BOOT_CFG:
+        offset: 0
+        len: 8
+        description: boot device selection
+      SEC_CONFIG:
+        offset: 8
+        len: 2
+        description: secure boot (closed) configuration
+      SRK_HASH:
+        offset: 16
+        len: 40
+  REG2:
+    bank: 0
+    word: 1
+    fuses:
+      SRK_LOCK:
+        offset: 0
+        len: 1
+  REG3:
+    bank: 0
+    word: 2
+    fuses:
+      MAC_ADDR:
+        offset: 0
+        len: 32
+`
+
+func names(matches []*Match) (n []string) {
+	for _, m := range matches {
+		n = append(n, m.Name())
+	}
+
+	return
+}
+
+func TestSearch(t *testing.T) {
+	f, err := Parse([]byte(searchMap))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address := func(a uint32) *uint32 { return &a }
+	bit := func(b int) *int { return &b }
+
+	tests := []struct {
+		query *Query
+		exp   []string
+	}{
+		{&Query{Name: "srk_*"}, []string{"SRK_HASH", "SRK_LOCK"}},
+		{&Query{Name: "REG?"}, []string{"REG1", "REG2", "REG3"}},
+		{&Query{Regexp: "^(boot|mac)_"}, []string{"BOOT_CFG", "MAC_ADDR"}},
+		{&Query{Keyword: "BOOT"}, []string{"REG1", "BOOT_CFG", "SEC_CONFIG"}},
+		{&Query{Name: "*CFG", Keyword: "boot"}, []string{"BOOT_CFG"}},
+		{&Query{Keyword: "fuse"}, nil},
+		{&Query{Address: address(0x00)}, []string{"REG1", "BOOT_CFG", "SEC_CONFIG", "SRK_HASH"}},
+		{&Query{Address: address(0x00), Bit: bit(9)}, []string{"REG1", "SEC_CONFIG"}},
+		{&Query{Address: address(0x04)}, []string{"REG2", "SRK_HASH", "SRK_LOCK"}},
+		{&Query{Address: address(0x04), Bit: bit(0)}, []string{"REG2", "SRK_HASH", "SRK_LOCK"}},
+		{&Query{Address: address(0x04), Bit: bit(31)}, []string{"REG2"}},
+		{&Query{Address: address(0x04), Bit: bit(5), Name: "SRK_*"}, []string{"SRK_HASH"}},
+		// REG3 is read at 0x0a and written at 0x08
+		{&Query{Address: address(0x08)}, []string{"REG3", "MAC_ADDR"}},
+		{&Query{Address: address(0x0a), Bit: bit(31)}, []string{"REG3", "MAC_ADDR"}},
+		{&Query{Address: address(0x0c)}, nil},
+	}
+
+	for i, test := range tests {
+		matches, err := f.Search(test.query)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if res := names(matches); !slices.Equal(res, test.exp) {
+			t.Errorf("unexpected search result (%d), %v != %v", i, res, test.exp)
+		}
+	}
+
+	for _, m := range f.At(0x04, 0) {
+		if m.Register.Name != "REG2" {
+			t.Errorf("unexpected match register, %s != REG2", m.Register.Name)
+		}
+	}
+}
+
+func TestInvalidSearch(t *testing.T) {
+	f, err := Parse([]byte(searchMap))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bit := 1
+
+	invalid := []*Query{
+		{Name: "[SRK"},
+		{Regexp: "(SRK"},
+		{Bit: &bit},
+	}
+
+	for _, q := range invalid {
+		if _, err := f.Search(q); err == nil {
+			t.Errorf("invalid query %+v should raise an error", q)
+		}
+	}
+
+	if _, err := (&FuseMap{}).Search(&Query{}); err == nil {
+		t.Error("search on an invalid fusemap should raise an error")
+	}
+}
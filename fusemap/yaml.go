@@ -34,6 +34,23 @@ func Parse(y []byte) (fusemap *FuseMap, err error) {
 // identifier within a directory. The YAML file is parsed, validated and
 // converted to a FuseMap structure.
 func Find(dir fs.FS, processor string, reference string) (fusemap *FuseMap, err error) {
+	fusemap, err = FindProcessor(dir, processor)
+
+	if err != nil {
+		return
+	}
+
+	if reference != fusemap.Reference {
+		err = fmt.Errorf("invalid reference")
+	}
+
+	return
+}
+
+// FindProcessor searches a fusemap YAML file for a given processor within a
+// directory, regardless of its reference manual identifier. The YAML file is
+// parsed, validated and converted to a FuseMap structure.
+func FindProcessor(dir fs.FS, processor string) (fusemap *FuseMap, err error) {
 	path := processor + ".yaml"
 
 	y, err := fs.ReadFile(dir, path)
@@ -53,10 +70,6 @@ func Find(dir fs.FS, processor string, reference string) (fusemap *FuseMap, err
 			processor, fusemap.Processor)
 	}
 
-	if reference != fusemap.Reference {
-		err = fmt.Errorf("invalid reference")
-	}
-
 	return
 }
 
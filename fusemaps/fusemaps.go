@@ -0,0 +1,30 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package fusemaps provides an embedded copy of the bundled reference
+// fusemaps, suitable for use on targets without a filesystem (e.g. TamaGo
+// bare-metal firmware).
+package fusemaps
+
+import (
+	"embed"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// FS holds the bundled reference fusemaps, vendor fusemaps (found in
+// subdirectories) are not included.
+//
+//go:embed *.yaml
+var FS embed.FS
+
+// Find returns a bundled reference fusemap for a given processor and
+// reference manual identifier, see fusemap.Find().
+func Find(processor string, reference string) (*fusemap.FuseMap, error) {
+	return fusemap.Find(FS, processor, reference)
+}
@@ -0,0 +1,48 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package fusemaps
+
+import (
+	"io/fs"
+	"strings"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestBundledFusemaps(t *testing.T) {
+	entries, err := fs.ReadDir(FS, ".")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(entries) == 0 {
+		t.Fatal("missing bundled fusemaps")
+	}
+
+	for _, e := range entries {
+		y, err := fs.ReadFile(FS, e.Name())
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		f, err := fusemap.Parse(y)
+
+		if err != nil {
+			t.Errorf("%s: %v", e.Name(), err)
+			continue
+		}
+
+		if _, err = Find(strings.TrimSuffix(e.Name(), ".yaml"), f.Reference); err != nil {
+			t.Errorf("%s: %v", e.Name(), err)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package manifest implements a declarative provisioning format to describe
+// One-Time-Programmable (OTP) fuse values and plan or apply their fusing.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this package is therefore **at your own risk**.
+package manifest
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/util"
+)
+
+// Manifest represents a collection of fuse values to be provisioned on a given
+// processor.
+type Manifest struct {
+	Processor string   `json:"processor"`
+	Reference string   `json:"reference"`
+	Fuses     []*Entry `json:"fuses"`
+}
+
+// Value represents a manifest fuse value, it must be expressed as a quoted
+// string to prevent YAML conversion of numeric values (e.g. 0x10 to 16) from
+// altering its interpretation.
+type Value string
+
+// UnmarshalJSON implements the json.Unmarshaler interface.
+func (v *Value) UnmarshalJSON(b []byte) (err error) {
+	var s string
+
+	if err = json.Unmarshal(b, &s); err != nil {
+		return fmt.Errorf("value %s must be a quoted string", b)
+	}
+
+	*v = Value(s)
+
+	return
+}
+
+// Entry represents a manifest register or fuse value.
+type Entry struct {
+	Name       string `json:"name"`
+	Value      Value  `json:"value"`
+	Base       int    `json:"base"`
+	Endianness string `json:"endianness"`
+	// Lock forces the entry to be fused after all non-lock entries, entries
+	// referring to lock fuses or registers are detected automatically.
+	Lock bool `json:"lock"`
+}
+
+// Bytes returns the entry value as a big-endian byte array.
+func (e *Entry) Bytes() (val []byte, err error) {
+	if val, err = util.ParseValue(string(e.Value), e.Base, e.Endianness); err != nil {
+		err = fmt.Errorf("%s: %v", e.Name, err)
+	}
+
+	return
+}
+
+// Parse converts a manifest YAML payload to a Manifest structure.
+func Parse(y []byte) (m *Manifest, err error) {
+	m = &Manifest{}
+
+	if err = yaml.Unmarshal(y, m); err != nil {
+		return
+	}
+
+	err = m.Validate()
+
+	return
+}
+
+// Open parses a manifest YAML file, validates it and converts it to a Manifest
+// structure.
+func Open(path string) (m *Manifest, err error) {
+	y, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	return Parse(y)
+}
+
+// Validate performs basic sanity checks on the manifest entries.
+func (m *Manifest) Validate() (err error) {
+	names := make(map[string]bool)
+
+	if m.Processor == "" {
+		return errors.New("missing processor")
+	}
+
+	if m.Reference == "" {
+		return errors.New("missing reference")
+	}
+
+	if len(m.Fuses) == 0 {
+		return errors.New("missing fuses")
+	}
+
+	for _, e := range m.Fuses {
+		if e == nil || e.Name == "" {
+			return errors.New("missing fuse name")
+		}
+
+		if _, ok := names[e.Name]; ok {
+			return fmt.Errorf("fuse names must be unique, double entry for %s", e.Name)
+		}
+		names[e.Name] = true
+
+		if _, err = e.Bytes(); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Check verifies that all manifest entries are compatible with the argument
+// fusemap.
+func (m *Manifest) Check(f *fusemap.FuseMap) (err error) {
+	if m.Processor != f.Processor {
+		return errors.New("processor mismatch")
+	}
+
+	if m.Reference != f.Reference {
+		return errors.New("reference mismatch")
+	}
+
+	for _, e := range m.Fuses {
+		if _, err = f.Find(e.Name); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,87 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package manifest
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/otp"
+)
+
+func nvmemReader(devicePath string, f *fusemap.FuseMap) Reader {
+	return func(name string) (res []byte, err error) {
+		res, _, _, _, err = otp.ReadNVMEM(devicePath, f, name)
+		return
+	}
+}
+
+// PlanNVMEM computes the difference between manifest values and the ones read
+// through Linux NVMEM subsystem framework, see Plan().
+func PlanNVMEM(devicePath string, f *fusemap.FuseMap, m *Manifest) (plan []*Action, err error) {
+	return Plan(f, m, nvmemReader(devicePath, f))
+}
+
+// ApplyNVMEM fuses planned values through Linux NVMEM subsystem framework, see
+// PlanNVMEM(). Fusing operations are recorded in the argument journal, if not
+// nil.
+//
+// Non-lock actions are fused and verified first, lock actions are fused and
+// verified last. The function refuses to operate on plans with conflicting
+// actions.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func ApplyNVMEM(devicePath string, f *fusemap.FuseMap, plan []*Action, j *otp.Journal) (err error) {
+	return ApplyNVMEMContext(context.Background(), devicePath, f, plan, j)
+}
+
+// ApplyNVMEMContext performs ApplyNVMEM() checking the argument context for
+// cancellation before each OTP word write, see otp.BlowNVMEMContext().
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func ApplyNVMEMContext(ctx context.Context, devicePath string, f *fusemap.FuseMap, plan []*Action, j *otp.Journal) (err error) {
+	read := nvmemReader(devicePath, f)
+
+	for _, a := range plan {
+		if a.Conflict() {
+			return fmt.Errorf("%s: current value %#x conflicts with %#x", a.Entry.Name, a.Current, a.Value)
+		}
+	}
+
+	for _, lock := range []bool{false, true} {
+		for _, a := range plan {
+			if a.Lock != lock || !a.Blow() {
+				continue
+			}
+
+			if _, _, _, _, _, err = j.BlowNVMEMContext(ctx, devicePath, f, a.Entry.Name, a.Value); err != nil {
+				return fmt.Errorf("%s: %w", a.Entry.Name, err)
+			}
+		}
+
+		if err = Verify(plan, lock, read); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,75 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestApply(t *testing.T) {
+	y := `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: SRK_LOCK
+    value: "1"
+    base: 2
+    endianness: big
+  - name: OCOTP_GP1
+    value: "0xaabbccdd"
+    base: 16
+    endianness: big
+...
+`
+
+	m, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempFile := filepath.Join(t.TempDir(), "nvmem")
+
+	if err = os.WriteFile(tempFile, make([]byte, 512), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := PlanNVMEM(tempFile, f, m)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = ApplyNVMEM(tempFile, f, plan, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if plan, err = PlanNVMEM(tempFile, f, m); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range plan {
+		if a.Blow() || a.Conflict() {
+			t.Errorf("applied manifest entry %s should not require fusing", a.Entry.Name)
+		}
+	}
+}
@@ -0,0 +1,263 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+var fusemaps = os.DirFS("../fusemaps")
+
+func TestInvalidManifest(t *testing.T) {
+	y := `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: MAC1_ADDR
+    value: 0x001f7b1007e3
+    base: 16
+    endianness: big
+...
+`
+
+	_, err := Parse([]byte(y))
+
+	if err == nil {
+		t.Error("manifest with unquoted value should raise an error")
+	}
+
+	y = `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: MAC1_ADDR
+    value: "0x001f7b1007e3"
+    base: 16
+    endianness: big
+  - name: MAC1_ADDR
+    value: "0x001f7b1007e3"
+    base: 16
+    endianness: big
+...
+`
+
+	_, err = Parse([]byte(y))
+
+	if err == nil || err.Error() != "fuse names must be unique, double entry for MAC1_ADDR" {
+		t.Error("manifest with duplicate entry should raise an error")
+	}
+
+	y = `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: MAC1_ADDR
+    value: "0x001f7b1007e3"
+    base: 16
+...
+`
+
+	_, err = Parse([]byte(y))
+
+	if err == nil || err.Error() != "MAC1_ADDR: invalid endianness" {
+		t.Error("manifest with missing endianness should raise an error")
+	}
+}
+
+func TestPlan(t *testing.T) {
+	y := `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: SRK_LOCK
+    value: "1"
+    base: 2
+    endianness: big
+  - name: MAC1_ADDR
+    value: "0x001f7b1007e3"
+    base: 16
+    endianness: big
+  - name: SI_REV
+    value: "0b0010"
+    base: 2
+    endianness: big
+  - name: OCOTP_GP1
+    value: "0xff000000"
+    base: 16
+    endianness: little
+...
+`
+
+	m, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := map[string][]byte{
+		"SRK_LOCK":  {0x00},
+		"MAC1_ADDR": {0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3},
+		"SI_REV":    {0x01},
+		"OCOTP_GP1": {0x00, 0x00, 0x00, 0x00},
+	}
+
+	plan, err := Plan(f, m, func(name string) ([]byte, error) {
+		return current[name], nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(plan) != 4 || plan[3].Entry.Name != "SRK_LOCK" || !plan[3].Lock {
+		t.Fatal("lock entries should be planned last")
+	}
+
+	for _, a := range plan {
+		var blow, conflict bool
+
+		switch a.Entry.Name {
+		case "SRK_LOCK":
+			blow = true
+		case "SI_REV":
+			conflict = true
+		case "OCOTP_GP1":
+			blow = true
+
+			if !bytes.Equal(a.Value, []byte{0x00, 0x00, 0x00, 0xff}) {
+				t.Errorf("unexpected little-endian value, %x", a.Value)
+			}
+		}
+
+		if a.Blow() != blow || a.Conflict() != conflict {
+			t.Errorf("unexpected plan for %s (blow:%v conflict:%v)", a.Entry.Name, a.Blow(), a.Conflict())
+		}
+	}
+
+	m.Reference = "2"
+
+	if _, err = Plan(f, m, nil); err == nil || err.Error() != "reference mismatch" {
+		t.Error("manifest with mismatching reference should raise an error")
+	}
+}
+
+func TestPlanLock(t *testing.T) {
+	y := `
+---
+processor: test
+reference: 1
+fuses:
+  - name: REG1
+    value: "1"
+    base: 2
+    endianness: big
+  - name: BLOCK_SIZE
+    value: "1"
+    base: 2
+    endianness: big
+  - name: FIELD_RETURN
+    value: "1"
+    base: 2
+    endianness: big
+  - name: MAC_ADDR_PROTECT
+    value: "1"
+    base: 2
+    endianness: big
+  - name: REG2
+    value: "1"
+    base: 2
+    endianness: big
+...
+`
+
+	fy := `
+---
+processor: test
+reference: 1
+driver: nvmem-imx-ocotp
+bank_size: 8
+registers:
+  REG0:
+    bank: 0
+    word: 0
+    lock: true
+    fuses:
+      MAC_ADDR_PROTECT:
+        offset: 0
+        len: 1
+  REG1:
+    bank: 0
+    word: 1
+    fuses:
+      BLOCK_SIZE:
+        offset: 0
+        len: 1
+      FIELD_RETURN:
+        offset: 1
+        len: 1
+        critical: true
+  REG2:
+    bank: 0
+    word: 2
+    fuses:
+      SEED_LOCK:
+        offset: 0
+        len: 1
+        lock: true
+...
+`
+
+	m, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fusemap.Parse([]byte(fy))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := Plan(f, m, func(name string) ([]byte, error) {
+		if name == "REG1" || name == "REG2" {
+			return make([]byte, 4), nil
+		}
+
+		return []byte{0x00}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, a := range plan {
+		if lock := a.Entry.Name != "BLOCK_SIZE"; a.Lock != lock {
+			t.Errorf("unexpected lock planning for %s (%v)", a.Entry.Name, a.Lock)
+		}
+	}
+
+	if plan[0].Entry.Name != "BLOCK_SIZE" {
+		t.Error("non lock entries should be planned first")
+	}
+}
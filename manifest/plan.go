@@ -0,0 +1,166 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/util"
+)
+
+// Reader represents a function which reads a register or fuse value, as
+// big-endian byte array, from a device (e.g. otp.ReadNVMEM()).
+type Reader func(name string) (res []byte, err error)
+
+// Action represents the planned fusing operation for a manifest entry.
+type Action struct {
+	// Entry is the manifest entry
+	Entry *Entry
+	// Current is the current register or fuse value (big-endian)
+	Current []byte
+	// Value is the manifest register or fuse value (big-endian)
+	Value []byte
+	// Lock indicates that the entry must be fused after non-lock ones
+	Lock bool
+}
+
+// Conflict returns whether the current value has fused bits which are not set
+// in the manifest value, as such bits cannot be cleared the manifest value
+// cannot be applied.
+func (a *Action) Conflict() bool {
+	for i := range a.Current {
+		if a.Current[i]&^a.Value[i] != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Blow returns whether the action requires a fusing operation.
+func (a *Action) Blow() bool {
+	return !a.Conflict() && !bytes.Equal(a.Current, a.Value)
+}
+
+// isLock returns whether a register or fuse must be fused after all other
+// ones, as it overlaps with critical registers or fuses, or it is (or belongs
+// to, or contains) a lock register or fuse.
+func isLock(f *fusemap.FuseMap, name string, mapping any) (bool, error) {
+	critical, err := f.Critical(name)
+
+	if err != nil || len(critical) > 0 {
+		return len(critical) > 0, err
+	}
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		if m.Lock {
+			return true, nil
+		}
+
+		for _, fuse := range m.Fuses {
+			if fuse != nil && fuse.Lock {
+				return true, nil
+			}
+		}
+	case *fusemap.Fuse:
+		return m.Lock || m.Register.Lock, nil
+	}
+
+	return false, nil
+}
+
+// Plan computes the difference between manifest values and the ones read from
+// a device. The returned actions are sorted in fusing order, with lock and
+// critical fuses or registers last (see fusemap Lock and Critical flags).
+func Plan(f *fusemap.FuseMap, m *Manifest, read Reader) (plan []*Action, err error) {
+	if err = m.Check(f); err != nil {
+		return
+	}
+
+	for _, e := range m.Fuses {
+		var bitLen int
+
+		mapping, err := f.Find(e.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		switch m := mapping.(type) {
+		case *fusemap.Register:
+			bitLen = m.Length
+		case *fusemap.Fuse:
+			bitLen = m.Length
+		}
+
+		val, err := e.Bytes()
+
+		if err != nil {
+			return nil, err
+		}
+
+		v := new(big.Int).SetBytes(val)
+
+		if v.BitLen() > bitLen {
+			return nil, fmt.Errorf("%s: value bit length %d exceeds %d", e.Name, v.BitLen(), bitLen)
+		}
+
+		lock, err := isLock(f, e.Name, mapping)
+
+		if err != nil {
+			return nil, err
+		}
+
+		cur, err := read(e.Name)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Name, err)
+		}
+
+		plan = append(plan, &Action{
+			Entry:   e,
+			Current: cur,
+			Value:   util.PadBigInt(v, bitLen),
+			Lock:    e.Lock || lock,
+		})
+	}
+
+	sort.SliceStable(plan, func(i, j int) bool {
+		return !plan[i].Lock && plan[j].Lock
+	})
+
+	return
+}
+
+// Verify compares the planned values, for lock or non-lock actions, against
+// the ones read from a device.
+func Verify(plan []*Action, lock bool, read Reader) (err error) {
+	for _, a := range plan {
+		if a.Lock != lock {
+			continue
+		}
+
+		res, err := read(a.Entry.Name)
+
+		if err != nil {
+			return fmt.Errorf("%s: %v", a.Entry.Name, err)
+		}
+
+		if !bytes.Equal(res, a.Value) {
+			return fmt.Errorf("%s: verification failed, %#x != %#x", a.Entry.Name, res, a.Value)
+		}
+	}
+
+	return
+}
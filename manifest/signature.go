@@ -0,0 +1,197 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// SignatureExtension represents the default detached signature file
+// extension, appended to the manifest path.
+const SignatureExtension = ".sig"
+
+// TrustStore represents the Ed25519 public keys authorized to sign manifests.
+type TrustStore []ed25519.PublicKey
+
+// ParseTrustStore converts PEM encoded Ed25519 public keys (PUBLIC KEY) or
+// X.509 certificates (CERTIFICATE) to a TrustStore.
+func ParseTrustStore(p []byte) (t TrustStore, err error) {
+	var block *pem.Block
+	var pub any
+
+	for {
+		if block, p = pem.Decode(p); block == nil {
+			break
+		}
+
+		switch block.Type {
+		case "PUBLIC KEY":
+			pub, err = x509.ParsePKIXPublicKey(block.Bytes)
+		case "CERTIFICATE":
+			var cert *x509.Certificate
+
+			if cert, err = x509.ParseCertificate(block.Bytes); err == nil {
+				pub = cert.PublicKey
+			}
+		default:
+			return nil, fmt.Errorf("unsupported PEM block type %s", block.Type)
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		key, ok := pub.(ed25519.PublicKey)
+
+		if !ok {
+			return nil, errors.New("only Ed25519 keys are supported")
+		}
+
+		t = append(t, key)
+	}
+
+	if len(bytes.TrimSpace(p)) > 0 {
+		return nil, errors.New("invalid PEM data")
+	}
+
+	if len(t) == 0 {
+		return nil, errors.New("missing trusted keys")
+	}
+
+	return
+}
+
+// OpenTrustStore parses a PEM file, or all PEM files (*.pem) within a
+// directory, and converts them to a TrustStore.
+func OpenTrustStore(path string) (t TrustStore, err error) {
+	var p []byte
+
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return
+	}
+
+	if !stat.IsDir() {
+		if p, err = os.ReadFile(path); err != nil {
+			return
+		}
+
+		return ParseTrustStore(p)
+	}
+
+	files, err := filepath.Glob(filepath.Join(path, "*.pem"))
+
+	if err != nil {
+		return
+	}
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+
+		if err != nil {
+			return nil, err
+		}
+
+		p = append(p, b...)
+		p = append(p, '\n')
+	}
+
+	if t, err = ParseTrustStore(p); err != nil {
+		err = fmt.Errorf("%s: %v", path, err)
+	}
+
+	return
+}
+
+// ParsePrivateKey converts a PEM encoded PKCS #8 Ed25519 private key (PRIVATE
+// KEY), such as the one generated with `openssl genpkey -algorithm ed25519`.
+func ParsePrivateKey(p []byte) (key ed25519.PrivateKey, err error) {
+	block, _ := pem.Decode(p)
+
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("invalid private key PEM block")
+	}
+
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+
+	if err != nil {
+		return
+	}
+
+	key, ok := k.(ed25519.PrivateKey)
+
+	if !ok {
+		return nil, errors.New("only Ed25519 keys are supported")
+	}
+
+	return
+}
+
+// Sign returns the base64 encoded Ed25519 detached signature of a manifest
+// YAML payload.
+func Sign(y []byte, key ed25519.PrivateKey) []byte {
+	sig := base64.StdEncoding.EncodeToString(ed25519.Sign(key, y))
+	return []byte(sig + "\n")
+}
+
+// Verify verifies the base64 encoded Ed25519 detached signature of a manifest
+// YAML payload against all trusted keys.
+func (t TrustStore) Verify(y []byte, sig []byte) (err error) {
+	s, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(sig)))
+
+	if err != nil || len(s) != ed25519.SignatureSize {
+		return errors.New("invalid signature format")
+	}
+
+	for _, key := range t {
+		if ed25519.Verify(key, y, s) {
+			return
+		}
+	}
+
+	return errors.New("signature verification failed")
+}
+
+// ParseSigned verifies a manifest YAML payload signature and, only if
+// successful, converts it to a Manifest structure.
+func ParseSigned(y []byte, sig []byte, t TrustStore) (m *Manifest, err error) {
+	if err = t.Verify(y, sig); err != nil {
+		return
+	}
+
+	return Parse(y)
+}
+
+// OpenSigned parses a manifest YAML file and its detached signature file,
+// verifies the signature against the argument trusted keys, validates the
+// manifest and converts it to a Manifest structure.
+func OpenSigned(path string, sigPath string, t TrustStore) (m *Manifest, err error) {
+	y, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	sig, err := os.ReadFile(sigPath)
+
+	if err != nil {
+		return
+	}
+
+	return ParseSigned(y, sig, t)
+}
@@ -0,0 +1,183 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package manifest
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const signedManifest = `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: MAC1_ADDR
+    value: "0x001f7b1007e3"
+    base: 16
+    endianness: big
+...
+`
+
+func generateKey(t *testing.T) (ed25519.PrivateKey, []byte) {
+	pub, key, err := ed25519.GenerateKey(rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err := x509.MarshalPKIXPublicKey(pub)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return key, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})
+}
+
+func TestSignedManifest(t *testing.T) {
+	key, pub := generateKey(t)
+	other, otherPub := generateKey(t)
+
+	trust, err := ParseTrustStore(append(otherPub, pub...))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trust) != 2 {
+		t.Fatalf("unexpected number of trusted keys, %d", len(trust))
+	}
+
+	y := []byte(signedManifest)
+	sig := Sign(y, key)
+
+	m, err := ParseSigned(y, sig, trust)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if m.Processor != "IMX6UL" || len(m.Fuses) != 1 {
+		t.Error("unexpected signed manifest content")
+	}
+
+	if _, err = ParseSigned(y, Sign(y, other), trust); err != nil {
+		t.Error(err)
+	}
+
+	tampered := []byte(strings.Replace(signedManifest, "07e3", "07e4", 1))
+
+	if _, err = ParseSigned(tampered, sig, trust); err == nil || err.Error() != "signature verification failed" {
+		t.Error("tampered manifest should raise an error")
+	}
+
+	trust, err = ParseTrustStore(otherPub)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseSigned(y, sig, trust); err == nil {
+		t.Error("manifest signed with untrusted key should raise an error")
+	}
+
+	if _, err = ParseSigned(y, []byte("invalid"), trust); err == nil || err.Error() != "invalid signature format" {
+		t.Error("invalid signature should raise an error")
+	}
+}
+
+func TestTrustStore(t *testing.T) {
+	key, pub := generateKey(t)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "release"},
+		NotBefore:    time.Now(),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, key.Public(), key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	dir := t.TempDir()
+
+	if err = os.WriteFile(filepath.Join(dir, "key.pem"), pub, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = os.WriteFile(filepath.Join(dir, "cert.pem"), cert, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	trust, err := OpenTrustStore(dir)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(trust) != 2 || !trust[0].Equal(trust[1]) {
+		t.Error("unexpected trusted keys")
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	der, err = x509.MarshalPKIXPublicKey(&ecKey.PublicKey)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ParseTrustStore(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der})); err == nil {
+		t.Error("non Ed25519 key should raise an error")
+	}
+
+	if _, err = ParseTrustStore(nil); err == nil {
+		t.Error("empty trust store should raise an error")
+	}
+
+	if _, err = OpenTrustStore(t.TempDir()); err == nil {
+		t.Error("empty trust store directory should raise an error")
+	}
+
+	der, err = x509.MarshalPKCS8PrivateKey(key)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	priv, err := ParsePrivateKey(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !priv.Equal(key) {
+		t.Error("unexpected private key")
+	}
+}
@@ -0,0 +1,105 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// SoC represents a detected System-on-Chip.
+type SoC struct {
+	// ID is the SoC identifier (e.g. `i.MX6UL`)
+	ID string
+	// Compatible lists the NVMEM device compatible strings
+	Compatible []string
+	// Processor is the matching fusemap processor model, empty when
+	// detection is ambiguous (see Candidates)
+	Processor string
+	// Candidates lists the matching fusemap processor models
+	Candidates []string
+}
+
+// Matches returns whether a fusemap processor model is among the ones
+// matching the SoC.
+func (soc *SoC) Matches(processor string) bool {
+	return slices.Contains(soc.Candidates, processor)
+}
+
+// ErrUnsupportedSoC is returned when neither the SoC identifier nor the NVMEM
+// device compatible strings match any supported processor model.
+var ErrUnsupportedSoC = errors.New("unsupported SoC")
+
+// socIDs maps SoC identifiers, as reported by the Linux SoC bus, to fusemap
+// processor models.
+var socIDs = map[string]string{
+	"i.MX53":   "IMX53",
+	"i.MX6Q":   "IMX6DQ",
+	"i.MX6DL":  "IMX6DL",
+	"i.MX6UL":  "IMX6UL",
+	"i.MX6ULL": "IMX6ULL",
+	"i.MX6ULZ": "IMX6ULZ",
+	"i.MX7D":   "IMX7D",
+	"i.MX8MQ":  "IMX8M",
+	"i.MX8MM":  "IMX8MM",
+	"i.MX8MP":  "IMX8MP",
+	"i.MX8QXP": "IMX8QXP",
+	"i.MX8QM":  "IMX8QM",
+	"i.MX93":   "IMX93",
+}
+
+// compatibles maps NVMEM device compatible strings to fusemap processor
+// models, a compatible string might be shared by more than one processor.
+var compatibles = map[string][]string{
+	"fsl,imx53-iim":          {"IMX53"},
+	"fsl,imx6q-ocotp":        {"IMX6DQ", "IMX6DL"},
+	"fsl,imx6ul-ocotp":       {"IMX6UL"},
+	"fsl,imx6ull-ocotp":      {"IMX6ULL", "IMX6ULZ"},
+	"fsl,imx7d-ocotp":        {"IMX7D"},
+	"fsl,imx8mq-ocotp":       {"IMX8M"},
+	"fsl,imx8mm-ocotp":       {"IMX8MM"},
+	"fsl,imx8mp-ocotp":       {"IMX8MP"},
+	"fsl,imx8qxp-scu-ocotp":  {"IMX8QXP"},
+	"fsl,imx8qm-scu-ocotp":   {"IMX8QM"},
+	"fsl,imx93-ocotp":        {"IMX93"},
+	"st,stm32mp15-bsec":      {"STM32MP15"},
+	"allwinner,sun8i-h3-sid": {"H3"},
+}
+
+// Identify returns the fusemap processor models matching a SoC identifier
+// and/or NVMEM device compatible strings, more than one model is returned when
+// the processor cannot be unambiguously identified (e.g. SoC identifier not
+// available and a compatible string shared by more than one processor). An
+// error is returned if they disagree.
+func Identify(id string, compatible []string) (processors []string, err error) {
+	var candidates []string
+
+	for _, c := range compatible {
+		if p, ok := compatibles[c]; ok {
+			candidates = p
+			break
+		}
+	}
+
+	if processor := socIDs[id]; processor != "" {
+		if len(candidates) > 0 && !slices.Contains(candidates, processor) {
+			return nil, fmt.Errorf("SoC %s does not match NVMEM device (%s)", id, strings.Join(compatible, ","))
+		}
+
+		return []string{processor}, nil
+	}
+
+	if len(candidates) == 0 {
+		return nil, ErrUnsupportedSoC
+	}
+
+	return slices.Clone(candidates), nil
+}
@@ -0,0 +1,87 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// SoCPath is the Linux SoC bus device used for SoC detection.
+var SoCPath = "/sys/devices/soc0"
+
+// ClockPath is the Linux common clock framework debugfs directory used for
+// clock rate detection.
+var ClockPath = "/sys/kernel/debug/clk"
+
+// ocotpClocks lists, in order of preference, the OCOTP controller clock
+// (ipg_clk) names used by the i.MX Linux clock drivers.
+var ocotpClocks = []string{"ocotp", "ocotp_root_clk", "ipg", "ipg_root"}
+
+func readAttribute(path string) string {
+	buf, err := os.ReadFile(path)
+
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(strings.TrimRight(string(buf), "\x00"))
+}
+
+// DetectSoC identifies the running SoC from its Linux SoC bus identifier (see
+// SoCPath) and the device tree compatible strings of the NVMEM device, see
+// Identify().
+func DetectSoC(devicePath string) (soc *SoC, err error) {
+	soc = &SoC{
+		ID: readAttribute(filepath.Join(SoCPath, "soc_id")),
+	}
+
+	compatible := readAttribute(filepath.Join(filepath.Dir(devicePath), "of_node", "compatible"))
+
+	for _, c := range strings.Split(compatible, "\x00") {
+		if c != "" {
+			soc.Compatible = append(soc.Compatible, c)
+		}
+	}
+
+	if soc.Candidates, err = Identify(soc.ID, soc.Compatible); err != nil {
+		return nil, err
+	}
+
+	if len(soc.Candidates) == 1 {
+		soc.Processor = soc.Candidates[0]
+	}
+
+	return
+}
+
+// OCOTPClockRate returns the OCOTP controller clock (ipg_clk) rate in Hz as
+// reported by the Linux clock tree (see ClockPath).
+func OCOTPClockRate() (rate uint64, err error) {
+	for _, name := range ocotpClocks {
+		val := readAttribute(filepath.Join(ClockPath, name, "clk_rate"))
+
+		if val == "" {
+			continue
+		}
+
+		if rate, err = strconv.ParseUint(val, 10, 64); err != nil || rate == 0 {
+			return 0, fmt.Errorf("invalid %s clock rate %q", name, val)
+		}
+
+		return
+	}
+
+	return 0, fmt.Errorf("could not find OCOTP clock rate in %s", ClockPath)
+}
@@ -0,0 +1,101 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectSoC(t *testing.T) {
+	dir := t.TempDir()
+	socPath := SoCPath
+	SoCPath = filepath.Join(dir, "soc0")
+
+	defer func() {
+		SoCPath = socPath
+	}()
+
+	nvmem := filepath.Join(dir, "imx-ocotp0")
+
+	for _, path := range []string{SoCPath, filepath.Join(nvmem, "of_node")} {
+		if err := os.MkdirAll(path, 0700); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for path, val := range map[string]string{
+		filepath.Join(SoCPath, "soc_id"):              "i.MX6ULL\n",
+		filepath.Join(nvmem, "of_node", "compatible"): "fsl,imx6ull-ocotp\x00syscon\x00",
+	} {
+		if err := os.WriteFile(path, []byte(val), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	soc, err := DetectSoC(filepath.Join(nvmem, "nvmem"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if soc.Processor != "IMX6ULL" || !soc.Matches("IMX6ULL") || len(soc.Compatible) != 2 {
+		t.Errorf("unexpected SoC detection, %+v", soc)
+	}
+
+	if err = os.Remove(filepath.Join(SoCPath, "soc_id")); err != nil {
+		t.Fatal(err)
+	}
+
+	if soc, err = DetectSoC(filepath.Join(nvmem, "nvmem")); err != nil {
+		t.Fatal(err)
+	}
+
+	if soc.Processor != "" || !soc.Matches("IMX6ULZ") || soc.Matches("IMX6UL") {
+		t.Errorf("unexpected ambiguous SoC detection, %+v", soc)
+	}
+
+	if err = os.WriteFile(filepath.Join(SoCPath, "soc_id"), []byte("i.MX6UL\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = DetectSoC(filepath.Join(nvmem, "nvmem")); err == nil {
+		t.Error("mismatching SoC and NVMEM device should raise an error")
+	}
+}
+
+func TestOCOTPClockRate(t *testing.T) {
+	clockPath := ClockPath
+	ClockPath = t.TempDir()
+
+	defer func() {
+		ClockPath = clockPath
+	}()
+
+	if _, err := OCOTPClockRate(); err == nil {
+		t.Error("missing clock tree should raise an error")
+	}
+
+	ipg := filepath.Join(ClockPath, "ipg")
+
+	if err := os.MkdirAll(ipg, 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(filepath.Join(ipg, "clk_rate"), []byte("66000000\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if rate, err := OCOTPClockRate(); err != nil || rate != 66000000 {
+		t.Errorf("unexpected clock rate (%d, %v)", rate, err)
+	}
+}
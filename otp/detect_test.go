@@ -0,0 +1,82 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"errors"
+	"slices"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestIdentify(t *testing.T) {
+	for _, test := range []struct {
+		id         string
+		compatible []string
+		processors []string
+		err        string
+	}{
+		{"i.MX6UL", []string{"fsl,imx6ul-ocotp", "syscon"}, []string{"IMX6UL"}, ""},
+		{"i.MX6ULZ", []string{"fsl,imx6ull-ocotp", "syscon"}, []string{"IMX6ULZ"}, ""},
+		{"i.MX6DL", nil, []string{"IMX6DL"}, ""},
+		{"", []string{"allwinner,sun8i-h3-sid"}, []string{"H3"}, ""},
+		{"", []string{"fsl,imx6ull-ocotp"}, []string{"IMX6ULL", "IMX6ULZ"}, ""},
+		{"i.MX6UL", []string{"fsl,imx6ull-ocotp"}, nil, "SoC i.MX6UL does not match NVMEM device (fsl,imx6ull-ocotp)"},
+		{"i.MX7ULP", []string{"fsl,imx7ulp-ocotp"}, nil, "unsupported SoC"},
+	} {
+		processors, err := Identify(test.id, test.compatible)
+
+		if test.err == ErrUnsupportedSoC.Error() && !errors.Is(err, ErrUnsupportedSoC) {
+			t.Errorf("%s %v: unsupported SoC should raise ErrUnsupportedSoC, %v", test.id, test.compatible, err)
+		}
+
+		if test.err != "" {
+			if err == nil || err.Error() != test.err {
+				t.Errorf("%s %v: unexpected error, %v", test.id, test.compatible, err)
+			}
+
+			continue
+		}
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !slices.Equal(processors, test.processors) {
+			t.Errorf("%s %v: unexpected processors, %v != %v", test.id, test.compatible, processors, test.processors)
+		}
+	}
+
+	soc := &SoC{Candidates: []string{"IMX6DQ", "IMX6DL"}}
+
+	if !soc.Matches("IMX6DL") || soc.Matches("IMX6UL") {
+		t.Error("unexpected SoC candidates matching")
+	}
+}
+
+func TestIdentifyFusemaps(t *testing.T) {
+	processors := make(map[string]bool)
+
+	for _, p := range socIDs {
+		processors[p] = true
+	}
+
+	for _, p := range compatibles {
+		for _, processor := range p {
+			processors[processor] = true
+		}
+	}
+
+	for processor := range processors {
+		if _, err := fusemap.FindProcessor(fusemaps, processor); err != nil {
+			t.Errorf("%s: %v", processor, err)
+		}
+	}
+}
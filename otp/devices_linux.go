@@ -0,0 +1,141 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// NVMEMPath is the Linux NVMEM bus devices directory.
+var NVMEMPath = "/sys/bus/nvmem/devices"
+
+// nvmemDrivers maps NVMEM device names, without their numeric suffix, to
+// fusemap drivers.
+var nvmemDrivers = map[string]string{
+	"imx-iim":       "nvmem-imx-iim",
+	"imx-ocotp":     "nvmem-imx-ocotp",
+	"ELE-OCOTP":     "nvmem-imx-ocotp-ele",
+	"imx-scu-ocotp": "nvmem-imx-scu-ocotp",
+	"stm32-romem":   "nvmem-stm32-romem",
+	"sunxi-sid":     "nvmem-sunxi-sid",
+}
+
+// NVMEMDevice represents a device registered on the Linux NVMEM bus.
+type NVMEMDevice struct {
+	// Name is the NVMEM device name (e.g. `imx-ocotp0`)
+	Name string
+	// Path is the NVMEM device file path
+	Path string
+	// Size is the NVMEM device size in bytes
+	Size int64
+	// Type is the NVMEM device type (e.g. `OTP`, `EEPROM`), if reported
+	Type string
+	// ReadOnly is set for devices which do not allow write operations
+	ReadOnly bool
+	// Driver is the matching fusemap driver, if any
+	Driver string
+}
+
+// NVMEMDevicePath returns the NVMEM device file path for a device name (e.g.
+// `imx-ocotp0`), paths are returned unmodified.
+func NVMEMDevicePath(name string) string {
+	if name == "" || strings.ContainsRune(name, os.PathSeparator) {
+		return name
+	}
+
+	return filepath.Join(NVMEMPath, name, "nvmem")
+}
+
+// driverName returns the fusemap driver matching an NVMEM device, either
+// through its kernel module or its name.
+func driverName(dir string, name string) string {
+	if module, err := filepath.EvalSymlinks(filepath.Join(dir, "device", "driver", "module")); err == nil {
+		d := strings.ReplaceAll(filepath.Base(module), "_", "-")
+
+		if _, ok := fusemap.Drivers[d]; ok {
+			return d
+		}
+	}
+
+	return nvmemDrivers[strings.TrimRight(name, "0123456789")]
+}
+
+// LookupNVMEMDevice returns the NVMEM bus device for a device name or file
+// path (see NVMEMDevicePath).
+func LookupNVMEMDevice(name string) (d *NVMEMDevice, err error) {
+	path := NVMEMDevicePath(name)
+	dir := filepath.Dir(path)
+
+	if filepath.Base(path) != "nvmem" || filepath.Dir(dir) != filepath.Clean(NVMEMPath) {
+		return nil, fmt.Errorf("%s is not an NVMEM bus device", name)
+	}
+
+	stat, err := os.Stat(path)
+
+	if err != nil {
+		return
+	}
+
+	d = &NVMEMDevice{
+		Name:     filepath.Base(dir),
+		Path:     path,
+		Size:     stat.Size(),
+		Type:     readAttribute(filepath.Join(dir, "type")),
+		ReadOnly: stat.Mode().Perm()&0222 == 0,
+	}
+
+	d.Driver = driverName(dir, d.Name)
+
+	return
+}
+
+// NVMEMDevices returns all devices registered on the Linux NVMEM bus, see
+// NVMEMPath.
+func NVMEMDevices() (devices []*NVMEMDevice, err error) {
+	entries, err := os.ReadDir(NVMEMPath)
+
+	if err != nil {
+		return
+	}
+
+	for _, e := range entries {
+		d, err := LookupNVMEMDevice(e.Name())
+
+		if err != nil {
+			continue
+		}
+
+		devices = append(devices, d)
+	}
+
+	return
+}
+
+// CheckNVMEMDevice verifies that an NVMEM bus device matches the fusemap
+// driver, paths outside the NVMEM bus (e.g. dump files) are not verified.
+func CheckNVMEMDevice(devicePath string, f *fusemap.FuseMap) (err error) {
+	d, err := LookupNVMEMDevice(devicePath)
+
+	if err != nil || d.Driver == "" {
+		return nil
+	}
+
+	if d.Driver != f.Driver {
+		return fmt.Errorf("NVMEM device %s driver %s does not match fusemap driver %s", d.Name, d.Driver, f.Driver)
+	}
+
+	return
+}
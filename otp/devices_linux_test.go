@@ -0,0 +1,97 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestNVMEMDevices(t *testing.T) {
+	nvmemPath := NVMEMPath
+	NVMEMPath = t.TempDir()
+
+	defer func() {
+		NVMEMPath = nvmemPath
+	}()
+
+	for _, d := range []struct {
+		name string
+		size int
+		perm os.FileMode
+	}{
+		{"imx-ocotp0", 512, 0644},
+		{"snvs_lpgpr0", 16, 0644},
+		{"stm32-romem0", 384, 0444},
+	} {
+		dir := filepath.Join(NVMEMPath, d.name)
+
+		if err := os.MkdirAll(dir, 0700); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "nvmem"), make([]byte, d.size), d.perm); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := os.WriteFile(filepath.Join(dir, "type"), []byte("OTP\n"), 0444); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	devices, err := NVMEMDevices()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(devices) != 3 {
+		t.Fatalf("unexpected number of devices, %d", len(devices))
+	}
+
+	for i, exp := range []NVMEMDevice{
+		{Name: "imx-ocotp0", Size: 512, Type: "OTP", Driver: "nvmem-imx-ocotp"},
+		{Name: "snvs_lpgpr0", Size: 16, Type: "OTP"},
+		{Name: "stm32-romem0", Size: 384, Type: "OTP", ReadOnly: true, Driver: "nvmem-stm32-romem"},
+	} {
+		d := devices[i]
+		exp.Path = filepath.Join(NVMEMPath, exp.Name, "nvmem")
+
+		if *d != exp {
+			t.Errorf("unexpected device, %+v != %+v", *d, exp)
+		}
+	}
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = CheckNVMEMDevice(NVMEMDevicePath("imx-ocotp0"), f); err != nil {
+		t.Error(err)
+	}
+
+	if err = CheckNVMEMDevice(NVMEMDevicePath("stm32-romem0"), f); err == nil {
+		t.Error("mismatching NVMEM device driver should raise an error")
+	}
+
+	if err = CheckNVMEMDevice(NVMEMDevicePath("snvs_lpgpr0"), f); err != nil {
+		t.Error("unknown NVMEM device driver should not raise an error")
+	}
+
+	if err = CheckNVMEMDevice(filepath.Join(t.TempDir(), "dump.bin"), f); err != nil {
+		t.Error("paths outside the NVMEM bus should not raise an error")
+	}
+}
@@ -0,0 +1,92 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"fmt"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"unsafe"
+)
+
+// DevMemPath is the physical memory device used for direct register access.
+var DevMemPath = "/dev/mem"
+
+// DevMem represents a memory mapped register file accessed through the Linux
+// physical memory device (see DevMemPath), it implements the MMIO interface.
+//
+// Direct register access bypasses the kernel OTP controller driver, which
+// should therefore not be loaded or in use by other processes.
+type DevMem struct {
+	file *os.File
+	mem  []byte
+	off  uint32
+	size uint32
+}
+
+// OpenDevMem maps a register file at the argument physical address.
+func OpenDevMem(addr uint32, size int) (m *DevMem, err error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid register file size %d", size)
+	}
+
+	file, err := os.OpenFile(DevMemPath, os.O_RDWR|os.O_SYNC, 0)
+
+	if err != nil {
+		return
+	}
+
+	page := uint32(os.Getpagesize())
+	base := addr &^ (page - 1)
+	off := addr - base
+
+	mem, err := syscall.Mmap(int(file.Fd()), int64(base), int(off)+size, syscall.PROT_READ|syscall.PROT_WRITE, syscall.MAP_SHARED)
+
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("could not map %#x, %v", addr, err)
+	}
+
+	return &DevMem{
+		file: file,
+		mem:  mem,
+		off:  off,
+		size: uint32(size),
+	}, nil
+}
+
+func (m *DevMem) reg(off uint32) *uint32 {
+	if off%4 != 0 || off+4 > m.size {
+		panic(fmt.Sprintf("invalid register offset %#x", off))
+	}
+
+	return (*uint32)(unsafe.Pointer(&m.mem[m.off+off]))
+}
+
+// Read returns a 32-bit register value.
+func (m *DevMem) Read(off uint32) uint32 {
+	return atomic.LoadUint32(m.reg(off))
+}
+
+// Write sets a 32-bit register value.
+func (m *DevMem) Write(off uint32, val uint32) {
+	atomic.StoreUint32(m.reg(off), val)
+}
+
+// Close unmaps the register file.
+func (m *DevMem) Close() (err error) {
+	if err = syscall.Munmap(m.mem); err != nil {
+		return
+	}
+
+	return m.file.Close()
+}
@@ -0,0 +1,106 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"fmt"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// ECCError represents a write to an ECC protected OTP word which already
+// holds data.
+//
+// ECC protected words (see fusemap Register.ECC) store an error correction
+// code computed at write time, a second write (e.g. of a different fuse
+// sharing the same word) results in a corrupted word. Such words must be fused
+// with their full value in a single write operation.
+type ECCError struct {
+	// Register is the ECC protected register name
+	Register string
+	// Address is the OTP word address
+	Address uint32
+	// Current is the OTP word value
+	Current []byte
+}
+
+func (e *ECCError) Error() string {
+	return fmt.Sprintf("%s at %#x is ECC protected and already fused (%#x), ECC words must be fused with their full value in a single operation as a further write would corrupt them", e.Register, e.Address, e.Current)
+}
+
+// LockError represents a write to an OTP word which is permanently write
+// locked.
+//
+// Some drivers (see fusemap Driver.WriteLock) permanently write lock OTP words
+// once programmed, any further write to such words fails.
+type LockError struct {
+	// Register is the write locked register name
+	Register string
+	// Address is the OTP word address
+	Address uint32
+	// Current is the OTP word value
+	Current []byte
+}
+
+func (e *LockError) Error() string {
+	return fmt.Sprintf("%s at %#x is already fused (%#x) and therefore permanently write locked", e.Register, e.Address, e.Current)
+}
+
+func empty(val []byte) bool {
+	for _, b := range val {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkWrite verifies that no read-only, or not writable by the fusemap driver,
+// OTP word is among the ones being written starting from the argument word
+// index (bank * bank size + word), and that no ECC protected or write locked
+// one already holds data. The read function returns the current value of the
+// i-th word being written.
+func checkWrite(f *fusemap.FuseMap, index int, n int, read func(i int) (addr uint32, val []byte, err error)) (err error) {
+	for i := 0; i < n; i++ {
+		r := f.RegisterAt(index + i)
+
+		switch {
+		case r != nil && r.ReadOnly:
+			return fmt.Errorf("%s is read-only", r.Name)
+		case !f.WritableWord(index + i):
+			return fmt.Errorf("OTP word %d cannot be blown through the %s driver", index+i, f.Driver)
+		}
+	}
+
+	for i := 0; i < n; i++ {
+		r := f.RegisterAt(index + i)
+
+		if r == nil || !r.ECC {
+			continue
+		}
+
+		addr, cur, err := read(i)
+
+		if err != nil {
+			return err
+		}
+
+		switch {
+		case empty(cur):
+			continue
+		case f.WriteLocked(r):
+			return &LockError{Register: r.Name, Address: addr, Current: cur}
+		default:
+			return &ECCError{Register: r.Name, Address: addr, Current: cur}
+		}
+	}
+
+	return
+}
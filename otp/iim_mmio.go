@@ -0,0 +1,189 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NXP IC Identification Module registers
+const (
+	iimStat  = 0x0000
+	iimErr   = 0x0008
+	iimFctl  = 0x0010
+	iimUA    = 0x0014
+	iimLA    = 0x0018
+	iimSdat  = 0x001c
+	iimPregP = 0x0028
+	iimBank  = 0x0800
+
+	statBusy = 1 << 7
+	statPrgd = 1 << 1
+	statSnsd = 1 << 0
+
+	errAll = 0xfe
+
+	fctlPrgLength = 0x7 << 4
+	fctlEsnsN     = 1 << 3
+	fctlPrg       = 1 << 0
+
+	pregPUnlock = 0xaa
+
+	iimBankSize  = 0x400
+	iimBankCount = 5
+	iimWordCount = 32
+
+	iimSize = iimBank + iimBankCount*iimBankSize
+)
+
+// IIMController represents an NXP IC Identification Module (IIM), as found on
+// i.MX5 series processors, operated through direct register access.
+//
+// Fuses are written one bit at the time through explicit programming
+// operations, while reads are served by the fuse bank registers which are
+// only updated at reset. Fuse values can be sensed directly, bypassing fuse
+// bank registers, with SenseWord().
+type IIMController struct {
+	// MMIO is the controller register file
+	MMIO MMIO
+	// Timeout is the operation timeout, DefaultTimeout is used when zero.
+	Timeout time.Duration
+}
+
+// WordSize returns the number of bytes per OTP word.
+func (hw *IIMController) WordSize() int {
+	return 1
+}
+
+func (hw *IIMController) checkIndex(index int) error {
+	if index < 0 || index >= iimBankCount*iimWordCount {
+		return fmt.Errorf("invalid OTP word index %d", index)
+	}
+
+	return nil
+}
+
+// prepare waits for the controller to be idle and clears any previous
+// operation status and error.
+func (hw *IIMController) prepare() (err error) {
+	if !wait(hw.MMIO, iimStat, statBusy, 0, hw.Timeout) {
+		return errors.New("IIM controller busy")
+	}
+
+	hw.MMIO.Write(iimStat, statPrgd|statSnsd)
+	hw.MMIO.Write(iimErr, errAll)
+
+	return
+}
+
+// setAddress sets the fuse address of an operation, fuse addresses are
+// expressed in bits (bank << 11 | row << 3 | bit) and split between the upper
+// (UA[5:3] bank, UA[2:0] row[7:5]) and lower (LA[7:3] row[4:0], LA[2:0] bit)
+// address registers.
+func (hw *IIMController) setAddress(index int, bit int) {
+	bank := index / iimWordCount
+	row := index % iimWordCount
+
+	hw.MMIO.Write(iimUA, uint32(bank<<3|row>>5)&0x3f)
+	hw.MMIO.Write(iimLA, uint32(row<<3|bit)&0xff)
+}
+
+// checkOp waits for an operation completion and reports its failure.
+func (hw *IIMController) checkOp(done uint32) (err error) {
+	if !wait(hw.MMIO, iimStat, statBusy|done, done, hw.Timeout) {
+		return errors.New("IIM operation timeout")
+	}
+
+	if e := hw.MMIO.Read(iimErr) & errAll; e != 0 {
+		hw.MMIO.Write(iimErr, errAll)
+		return fmt.Errorf("IIM operation error (%#x)", e)
+	}
+
+	return
+}
+
+// ReadWord reads an OTP word from its fuse bank register.
+func (hw *IIMController) ReadWord(index int) (val uint32, err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	bank := index / iimWordCount
+	word := index % iimWordCount
+
+	return hw.MMIO.Read(iimBank+uint32(bank*iimBankSize+word*4)) & 0xff, nil
+}
+
+// BlowWord fuses an OTP word, one bit at the time. Fuse bank registers are
+// not updated until the next reset.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func (hw *IIMController) BlowWord(index int, val uint32) (err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	if val > 0xff {
+		return fmt.Errorf("value %#x exceeds OTP word size", val)
+	}
+
+	if err = hw.prepare(); err != nil {
+		return
+	}
+
+	hw.MMIO.Write(iimPregP, pregPUnlock)
+	defer hw.MMIO.Write(iimPregP, 0)
+
+	for bit := 0; bit < 8; bit++ {
+		if val&(1<<bit) == 0 {
+			continue
+		}
+
+		hw.setAddress(index, bit)
+		hw.MMIO.Write(iimFctl, fctlPrgLength|fctlPrg)
+
+		if err = hw.checkOp(statPrgd); err != nil {
+			return fmt.Errorf("bit %d, %v", bit, err)
+		}
+
+		hw.MMIO.Write(iimStat, statPrgd)
+	}
+
+	return
+}
+
+// SenseWord reads an OTP word directly from its fuses, through an explicit
+// sense operation, bypassing its fuse bank register.
+func (hw *IIMController) SenseWord(index int) (val uint32, err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	if err = hw.prepare(); err != nil {
+		return
+	}
+
+	hw.setAddress(index, 0)
+	hw.MMIO.Write(iimFctl, fctlEsnsN)
+
+	if err = hw.checkOp(statSnsd); err != nil {
+		return
+	}
+
+	hw.MMIO.Write(iimStat, statSnsd)
+
+	return hw.MMIO.Read(iimSdat) & 0xff, nil
+}
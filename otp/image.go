@@ -0,0 +1,48 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"context"
+	"io"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// ReadImage reads a register or fuse from a raw copy of an NVMEM device (e.g.
+// obtained with `dd`), for offline analysis, with the same semantics of
+// ReadNVMEM(). The name argument could be a register or an individual OTP
+// fuse.
+//
+// JSON and YAML snapshots must be decoded first, see OpenSnapshot().
+func ReadImage(r io.ReaderAt, f *fusemap.FuseMap, name string) (res []byte, addr uint32, off int, bitLen int, err error) {
+	addr, off, bitLen, err = readParams(f, name)
+
+	if err != nil {
+		return
+	}
+
+	res, err = readNVMEM(context.Background(), r, f, addr, off, bitLen)
+
+	return
+}
+
+// ReadWordsImage reads all OTP words covered by a register or fuse from a raw
+// copy of an NVMEM device, with the same semantics of ReadWordsNVMEM().
+func ReadWordsImage(r io.ReaderAt, f *fusemap.FuseMap, name string) (words []byte, addr uint32, err error) {
+	addr, off, bitLen, err := readParams(f, name)
+
+	if err != nil {
+		return
+	}
+
+	words, err = readRaw(context.Background(), r, f, addr, off, bitLen)
+
+	return
+}
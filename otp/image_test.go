@@ -0,0 +1,82 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestReadImage(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf, err := os.ReadFile("../test/nvmem.IMX6UL")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	image := bytes.NewReader(buf)
+
+	res, addr, _, _, err := ReadImage(image, f, "OCOTP_OTPMK0")
+
+	if err != nil || addr != 0x40 || !bytes.Equal(res, []byte{0xba, 0xda, 0xba, 0xda}) {
+		t.Errorf("unexpected image read (%x %#x %v)", res, addr, err)
+	}
+
+	// test post gap addressing
+	res, addr, _, _, err = ReadImage(image, f, "OCOTP_GP30")
+
+	if err != nil || addr != 0x140 || !bytes.Equal(res, []byte{0x00, 0x00, 0x00, 0x00}) {
+		t.Errorf("unexpected image read (%x %#x %v)", res, addr, err)
+	}
+
+	words, addr, err := ReadWordsImage(image, f, "MAC1_ADDR")
+
+	if err != nil || addr != 0x22*4 || len(words) != 2*f.WordSize {
+		t.Errorf("unexpected image words read (%x %#x %v)", words, addr, err)
+	}
+
+	raw := bytes.Clone(words)
+	res, _, _, err = DecodeWords(f, "MAC1_ADDR", words)
+
+	if err != nil || !bytes.Equal(res, []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}) {
+		t.Errorf("unexpected decoded words (%x %v)", res, err)
+	}
+
+	if !bytes.Equal(words, raw) {
+		t.Errorf("decoding should not alter words (%x != %x)", words, raw)
+	}
+
+	if _, _, _, err = DecodeWords(f, "MAC1_ADDR", words[:f.WordSize]); err == nil {
+		t.Error("insufficient words should raise an error")
+	}
+
+	s := &Snapshot{Words: buf}
+
+	for name := range f.Registers {
+		exp, _, _, _, expErr := s.Read(f, name)
+		res, _, _, _, err = ReadImage(image, f, name)
+
+		if (err != nil) != (expErr != nil) || !bytes.Equal(res, exp) {
+			t.Errorf("%s: image read does not match snapshot (%x != %x, %v)", name, res, exp, err)
+		}
+	}
+
+	if _, _, _, _, err = ReadImage(bytes.NewReader(nil), f, "OCOTP_OTPMK0"); err == nil {
+		t.Error("empty image should raise an error")
+	}
+}
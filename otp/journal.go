@@ -0,0 +1,203 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// Journal record operations
+const (
+	// JournalBegin records the intent to fuse a register or fuse
+	JournalBegin = "begin"
+	// JournalWrite records the intent to write an OTP word
+	JournalWrite = "write"
+	// JournalWritten records the completion of an OTP word write
+	JournalWritten = "written"
+	// JournalEnd records the completion, or failure, of a fusing operation
+	JournalEnd = "end"
+)
+
+// JournalRecord represents a single journal entry.
+type JournalRecord struct {
+	Op   string    `json:"op"`
+	Time time.Time `json:"time"`
+
+	// operation intent (JournalBegin)
+	Device    string `json:"device,omitempty"`
+	Processor string `json:"processor,omitempty"`
+	Reference string `json:"reference,omitempty"`
+	Name      string `json:"name,omitempty"`
+	WordSize  int    `json:"word_size,omitempty"`
+
+	ReadAddress  uint32 `json:"read_address,omitempty"`
+	WriteAddress uint32 `json:"write_address,omitempty"`
+	// Value holds all words (JournalBegin) or a single one (JournalWrite,
+	// JournalWritten) in write order.
+	Value Words `json:"value,omitempty"`
+
+	// operation outcome (JournalEnd)
+	Error string `json:"error,omitempty"`
+}
+
+// Journal represents an append-only record of multi-word fusing operations,
+// each record is synchronized to storage before any OTP word write takes
+// place to allow recovery of interrupted operations.
+type Journal struct {
+	path string
+	file *os.File
+}
+
+// OpenJournal opens, or creates, a journal file.
+func OpenJournal(path string) (j *Journal, err error) {
+	if err = os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND|os.O_SYNC, 0600)
+
+	if err != nil {
+		return
+	}
+
+	j = &Journal{path: path, file: file}
+
+	// terminate any record interrupted by power loss
+	if buf, _ := os.ReadFile(path); len(buf) > 0 && buf[len(buf)-1] != '\n' {
+		if _, err = file.Write([]byte{'\n'}); err != nil {
+			_ = file.Close()
+			return nil, err
+		}
+	}
+
+	return
+}
+
+// Path returns the journal file path.
+func (j *Journal) Path() string {
+	return j.path
+}
+
+// Close closes the journal file.
+func (j *Journal) Close() error {
+	return j.file.Close()
+}
+
+func (j *Journal) record(r *JournalRecord) (err error) {
+	r.Time = time.Now().UTC()
+
+	buf, err := json.Marshal(r)
+
+	if err != nil {
+		return
+	}
+
+	if _, err = j.file.Write(append(buf, '\n')); err != nil {
+		return
+	}
+
+	return j.file.Sync()
+}
+
+func (j *Journal) begin(devicePath string, f *fusemap.FuseMap, name string, raddr uint32, waddr uint32, val []byte) error {
+	return j.record(&JournalRecord{
+		Op:           JournalBegin,
+		Device:       devicePath,
+		Processor:    f.Processor,
+		Reference:    f.Reference,
+		Name:         name,
+		WordSize:     f.WordSize,
+		ReadAddress:  raddr,
+		WriteAddress: waddr,
+		Value:        val,
+	})
+}
+
+// end records the outcome of a fusing operation and returns its error, a
+// failure to record a successful outcome is returned instead. Cancelled
+// operations are not recorded as completed, to allow their resumption.
+func (j *Journal) end(err error) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return err
+	}
+
+	r := &JournalRecord{Op: JournalEnd}
+
+	if err != nil {
+		r.Error = err.Error()
+	}
+
+	if jerr := j.record(r); err == nil {
+		return jerr
+	}
+
+	return err
+}
+
+// ReadJournal parses all journal file records.
+func ReadJournal(path string) (records []*JournalRecord, err error) {
+	file, err := os.Open(path)
+
+	if err != nil {
+		return
+	}
+	defer func() { _ = file.Close() }()
+
+	scanner := bufio.NewScanner(file)
+
+	for n := 1; scanner.Scan(); n++ {
+		r := &JournalRecord{}
+
+		if err = json.Unmarshal(scanner.Bytes(), r); err != nil {
+			// a record interrupted by power loss can only be the last one
+			if !scanner.Scan() {
+				break
+			}
+
+			return nil, fmt.Errorf("invalid journal record at line %d, %v", n, err)
+		}
+
+		records = append(records, r)
+	}
+
+	return records, scanner.Err()
+}
+
+// Pending returns the records of the last fusing operation if it was
+// interrupted before completion, its first record always represents the
+// operation intent (JournalBegin).
+func Pending(records []*JournalRecord) (pending []*JournalRecord, err error) {
+	for _, r := range records {
+		switch r.Op {
+		case JournalBegin:
+			pending = []*JournalRecord{r}
+		case JournalWrite, JournalWritten:
+			if pending == nil {
+				return nil, errors.New("invalid journal, word record without operation")
+			}
+
+			pending = append(pending, r)
+		case JournalEnd:
+			pending = nil
+		default:
+			return nil, fmt.Errorf("invalid journal, unknown operation %s", r.Op)
+		}
+	}
+
+	return
+}
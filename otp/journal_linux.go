@@ -0,0 +1,217 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// BlowNVMEM performs BlowNVMEM() recording each OTP word write within the
+// journal, see ResumeNVMEM() for recovery of interrupted operations. A nil
+// journal performs no journaling.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func (j *Journal) BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (res []byte, addr uint32, off int, bitLen int, words []Word, err error) {
+	return blowNVMEM(context.Background(), devicePath, f, name, val, j)
+}
+
+// BlowNVMEMContext performs a journaled BlowNVMEMContext().
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func (j *Journal) BlowNVMEMContext(ctx context.Context, devicePath string, f *fusemap.FuseMap, name string, val []byte) (res []byte, addr uint32, off int, bitLen int, words []Word, err error) {
+	return blowNVMEM(ctx, devicePath, f, name, val, j)
+}
+
+// landed returns whether all bits of an OTP word value are fused.
+func landed(cur []byte, val []byte) bool {
+	for i := range val {
+		if cur[i]&val[i] != val[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// resumeIndex returns the first OTP word index of a journal operation,
+// verifying that it matches the argument fusemap.
+func resumeIndex(f *fusemap.FuseMap, op *JournalRecord) (index int, err error) {
+	if f == nil || !f.Valid() {
+		return 0, errors.New("fusemap has not been validated yet")
+	}
+
+	if f.Processor != op.Processor || f.Reference != op.Reference || f.WordSize != op.WordSize {
+		return 0, errors.New("journal fusemap mismatch")
+	}
+
+	mapping, err := f.Find(op.Name)
+
+	if err != nil {
+		return
+	}
+
+	var reg *fusemap.Register
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		reg = m
+	case *fusemap.Fuse:
+		reg = m.Register
+	}
+
+	if reg.ReadAddress != op.ReadAddress || reg.WriteAddress != op.WriteAddress {
+		return 0, errors.New("journal fusemap mismatch")
+	}
+
+	return f.Index(reg), nil
+}
+
+// ResumeNVMEM completes the last journal operation, if interrupted, through
+// Linux NVMEM subsystem framework. Each OTP word of the operation is read
+// back and written only if its value did not land on the device before
+// interruption.
+//
+// The interrupted operation intent is returned, along with the write address
+// of all words which required writing, a nil intent is returned when no
+// operation requires completion. An empty NVMEM device path selects the one
+// recorded in the journal.
+//
+// The argument fusemap must match the one of the interrupted operation, words
+// are written only if allowed by its register definitions: read-only words are
+// always refused, ECC protected words which already hold data are refused with
+// an *ECCError.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func (j *Journal) ResumeNVMEM(devicePath string, f *fusemap.FuseMap) (op *JournalRecord, written []uint32, err error) {
+	return j.ResumeNVMEMContext(context.Background(), devicePath, f)
+}
+
+// ResumeNVMEMContext performs ResumeNVMEM() checking the argument context for
+// cancellation before each OTP word operation. An OTP word write is never
+// interrupted, a cancelled operation remains pending in the journal.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func (j *Journal) ResumeNVMEMContext(ctx context.Context, devicePath string, f *fusemap.FuseMap) (op *JournalRecord, written []uint32, err error) {
+	records, err := ReadJournal(j.path)
+
+	if err != nil {
+		return
+	}
+
+	pending, err := Pending(records)
+
+	if err != nil || len(pending) == 0 {
+		return
+	}
+
+	op = pending[0]
+
+	if devicePath == "" {
+		devicePath = op.Device
+	}
+
+	if devicePath != op.Device {
+		return nil, nil, fmt.Errorf("journal device mismatch (%s != %s)", devicePath, op.Device)
+	}
+
+	if op.WordSize <= 0 || len(op.Value)%op.WordSize != 0 {
+		return nil, nil, errors.New("invalid journal, malformed operation")
+	}
+
+	index, err := resumeIndex(f, op)
+
+	if err != nil {
+		return nil, nil, err
+	}
+
+	unlock, err := lockNVMEM(ctx, devicePath)
+
+	if err != nil {
+		return nil, nil, err
+	}
+	defer unlock()
+
+	device, err := os.OpenFile(devicePath, os.O_RDWR|os.O_EXCL|os.O_SYNC, 0600)
+
+	if err != nil {
+		return
+	}
+	// make errcheck happy
+	defer func() { _ = device.Close() }()
+
+	defer func() { err = j.end(err) }()
+
+	cur := make([]byte, op.WordSize)
+
+	for _, verify := range []bool{false, true} {
+		for i := 0; i < len(op.Value); i += op.WordSize {
+			val := op.Value[i : i+op.WordSize]
+
+			if err = ctx.Err(); err != nil {
+				return
+			}
+
+			if _, err = device.ReadAt(cur, int64(op.ReadAddress)+int64(i)); err != nil {
+				return
+			}
+
+			if landed(cur, val) {
+				continue
+			}
+
+			if verify {
+				return op, written, fmt.Errorf("word at %#x did not land (%#x != %#x)", op.WriteAddress+uint32(i), cur, val)
+			}
+
+			err = checkWrite(f, index+i/op.WordSize, 1, func(int) (uint32, []byte, error) {
+				return op.ReadAddress + uint32(i), slices.Clone(cur), nil
+			})
+
+			if err != nil {
+				return
+			}
+
+			if err = writeWord(device, j, op.WriteAddress+uint32(i), val); err != nil {
+				return
+			}
+
+			written = append(written, op.WriteAddress+uint32(i))
+		}
+	}
+
+	return
+}
@@ -0,0 +1,210 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestJournalBlow(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	devicePath := filepath.Join(tempDir, "nvmem")
+	journalPath := filepath.Join(tempDir, "journal", "crucible.log")
+
+	if err = os.WriteFile(devicePath, make([]byte, 512), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := OpenJournal(journalPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+
+	if _, _, _, _, _, err = j.BlowNVMEM(devicePath, f, "MAC1_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := ReadJournal(journalPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ops := []string{JournalBegin, JournalWrite, JournalWritten, JournalWrite, JournalWritten, JournalEnd}
+
+	if len(records) != len(ops) {
+		t.Fatalf("unexpected number of journal records, %d != %d", len(records), len(ops))
+	}
+
+	for i, r := range records {
+		if r.Op != ops[i] {
+			t.Errorf("unexpected journal record %d, %s != %s", i, r.Op, ops[i])
+		}
+	}
+
+	if records[0].Name != "MAC1_ADDR" || records[0].WriteAddress != 0x88 || records[3].WriteAddress != 0x8c {
+		t.Error("unexpected journal record addressing")
+	}
+
+	pending, err := Pending(records)
+
+	if err != nil || pending != nil {
+		t.Error("completed journal should not have pending operations")
+	}
+}
+
+func TestJournalResume(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	devicePath := filepath.Join(tempDir, "nvmem")
+	journalPath := filepath.Join(tempDir, "journal")
+
+	nvmem := make([]byte, 512)
+	val := []byte{0xe3, 0x07, 0x10, 0x7b, 0x1f, 0x00, 0x00, 0x00}
+
+	// simulate an interruption after the first word write
+	copy(nvmem[0x88:], val[0:4])
+
+	if err = os.WriteFile(devicePath, nvmem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := OpenJournal(journalPath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+
+	if err = j.begin(devicePath, f, "MAC1_ADDR", 0x88, 0x88, val); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = j.record(&JournalRecord{Op: JournalWrite, WriteAddress: 0x88, Value: val[0:4]}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = j.ResumeNVMEM("invalid", f); err == nil {
+		t.Error("resuming against a different device should raise an error")
+	}
+
+	op, written, err := j.ResumeNVMEM("", f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if op == nil || op.Name != "MAC1_ADDR" {
+		t.Fatal("resume should return the interrupted operation")
+	}
+
+	if len(written) != 1 || written[0] != 0x8c {
+		t.Errorf("resume should write only missing words (%x)", written)
+	}
+
+	res, _, _, _, err := ReadNVMEM(devicePath, f, "MAC1_ADDR")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}; !bytes.Equal(res, exp) {
+		t.Errorf("resumed operation with unexpected value, %x != %x", res, exp)
+	}
+
+	if op, _, err = j.ResumeNVMEM("", f); err != nil || op != nil {
+		t.Error("completed journal should not have pending operations")
+	}
+}
+
+func TestJournalResumeECC(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX8MP", "0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	devicePath := filepath.Join(tempDir, "nvmem")
+
+	nvmem := make([]byte, 1024)
+	val := []byte{0xe3, 0x07, 0x10, 0x7b, 0x1f, 0x00, 0x00, 0x00}
+
+	// simulate a second write attempt on an already fused ECC word
+	nvmem[0x94] = 0x01
+
+	if err = os.WriteFile(devicePath, nvmem, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	j, err := OpenJournal(filepath.Join(tempDir, "journal"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+
+	if err = j.begin(devicePath, f, "MAC_0_ADDR", 0x90, 0x90, val); err != nil {
+		t.Fatal(err)
+	}
+
+	other, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err = j.ResumeNVMEM("", other); err == nil || err.Error() != "journal fusemap mismatch" {
+		t.Errorf("resuming with a different fusemap should raise an error (%v)", err)
+	}
+
+	var eccErr *ECCError
+
+	_, written, err := j.ResumeNVMEM("", f)
+
+	if !errors.As(err, &eccErr) || eccErr.Register != "OCOTP_MAC_ADDR1" || eccErr.Address != 0x94 {
+		t.Fatalf("resume on fused ECC word should raise an ECCError (%v)", err)
+	}
+
+	// the first, empty, ECC word is written before the refusal
+	if len(written) != 1 || written[0] != 0x90 {
+		t.Errorf("unexpected resumed words (%x)", written)
+	}
+
+	if buf, _ := os.ReadFile(devicePath); buf[0x94] != 0x01 || !bytes.Equal(buf[0x95:0x98], []byte{0x00, 0x00, 0x00}) {
+		t.Errorf("refused ECC write should not alter the word (%x)", buf[0x94:0x98])
+	}
+}
@@ -0,0 +1,215 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// LockDir is the directory holding NVMEM device lock files, the system
+// temporary directory is used when not present.
+//
+// Each NVMEM device is associated to a `crucible-<name>.lock` file, where
+// `<name>` is the NVMEM device name (e.g. `imx-ocotp0`) or, for paths outside
+// the NVMEM subsystem, the device absolute path with separators replaced by
+// dashes. Other processes operating on the same device can cooperate by
+// holding an exclusive flock(2) on the same file.
+//
+// Lock files are opened without following symbolic links and must be regular
+// files owned by the current user, root or the LockGroup, as the directory
+// might be writable by others. Lock holders record their process identifier in
+// HDB UUCP format (`%10d\n`).
+var LockDir = "/run/lock"
+
+// LockGroup is the name of the group sharing NVMEM device lock files among
+// users, such as a factory daemon and operators. When the group exists, lock
+// files owned by it are accepted and lock files owned by the current user are
+// assigned to it, with group write permission.
+var LockGroup = "crucible"
+
+// LockTimeout is the maximum time to wait for an NVMEM device lock held by
+// another process.
+var LockTimeout = 10 * time.Second
+
+// BusyError represents an NVMEM device locked by another process.
+type BusyError struct {
+	// Device is the NVMEM device path
+	Device string
+	// PID is the process identifier of the lock holder, if known
+	PID int
+}
+
+func (e *BusyError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("device busy (%s)", e.Device)
+	}
+
+	return fmt.Sprintf("device busy, held by pid %d (%s)", e.PID, e.Device)
+}
+
+// LockPath returns the lock file path for an NVMEM device, see LockDir.
+func LockPath(devicePath string) string {
+	dir := LockDir
+
+	if stat, err := os.Stat(dir); err != nil || !stat.IsDir() {
+		dir = os.TempDir()
+	}
+
+	path, err := filepath.Abs(devicePath)
+
+	if err != nil {
+		path = devicePath
+	}
+
+	name := filepath.Base(filepath.Dir(path))
+
+	if filepath.Base(path) != "nvmem" {
+		name = strings.ReplaceAll(strings.Trim(path, "/"), "/", "-")
+	}
+
+	return filepath.Join(dir, "crucible-"+name+".lock")
+}
+
+// lockGroupID returns the LockGroup identifier, -1 is returned when the group
+// is not defined.
+func lockGroupID() int {
+	if LockGroup == "" {
+		return -1
+	}
+
+	group, err := user.LookupGroup(LockGroup)
+
+	if err != nil {
+		return -1
+	}
+
+	gid, err := strconv.Atoi(group.Gid)
+
+	if err != nil {
+		return -1
+	}
+
+	return gid
+}
+
+// trustedLockOwner returns whether a lock file owned by the argument user and
+// group identifiers can be used, being owned by the current user, root or the
+// lock group (-1 when not defined).
+func trustedLockOwner(uid int, gid int, group int) bool {
+	return uid == os.Geteuid() || uid == 0 || (group >= 0 && gid == group)
+}
+
+// openLock opens, or creates, a lock file refusing symbolic links as well as
+// files which are not regular or not owned by a trusted user or group (see
+// trustedLockOwner()). Lock files which cannot be written, such as the ones
+// created by root, are opened read-only.
+func openLock(path string) (file *os.File, err error) {
+	flag := syscall.O_NOFOLLOW | syscall.O_CLOEXEC
+
+	if file, err = os.OpenFile(path, os.O_RDWR|os.O_CREATE|flag, 0644); errors.Is(err, os.ErrPermission) {
+		file, err = os.OpenFile(path, os.O_RDONLY|flag, 0)
+	}
+
+	if err != nil {
+		return
+	}
+
+	stat, err := file.Stat()
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	group := lockGroupID()
+
+	switch sys, ok := stat.Sys().(*syscall.Stat_t); {
+	case !stat.Mode().IsRegular():
+		err = fmt.Errorf("%s is not a regular file", path)
+	case !ok || !trustedLockOwner(int(sys.Uid), int(sys.Gid), group):
+		err = fmt.Errorf("%s is not owned by the current user, root or the %s group", path, LockGroup)
+	case group >= 0 && int(sys.Uid) == os.Geteuid():
+		// share the lock file with other lock group members
+		if file.Chown(-1, group) == nil {
+			_ = file.Chmod(0664)
+		}
+	}
+
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+
+	return
+}
+
+// lockNVMEM acquires an exclusive lock on an NVMEM device, waiting up to
+// LockTimeout, or context cancellation, for other processes to release it.
+// The returned function releases the lock.
+func lockNVMEM(ctx context.Context, devicePath string) (unlock func(), err error) {
+	file, err := openLock(LockPath(devicePath))
+
+	if err != nil {
+		return nil, fmt.Errorf("could not open lock file, %v", err)
+	}
+
+	fd := int(file.Fd())
+	deadline := time.Now().Add(LockTimeout)
+
+	for {
+		err = syscall.Flock(fd, syscall.LOCK_EX|syscall.LOCK_NB)
+
+		if err == nil {
+			break
+		}
+
+		if !errors.Is(err, syscall.EWOULDBLOCK) {
+			_ = file.Close()
+			return nil, fmt.Errorf("could not lock device, %v", err)
+		}
+
+		if time.Now().After(deadline) {
+			buf := make([]byte, 11)
+			n, _ := file.ReadAt(buf, 0)
+			pid, _ := strconv.Atoi(strings.TrimSpace(string(buf[:n])))
+			_ = file.Close()
+
+			return nil, &BusyError{Device: devicePath, PID: pid}
+		}
+
+		select {
+		case <-ctx.Done():
+			_ = file.Close()
+			return nil, ctx.Err()
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	// record lock holder, the fixed width format overwrites any previous
+	// one without truncating the file (ignored on read-only lock files)
+	_, _ = file.WriteAt([]byte(fmt.Sprintf("%10d\n", os.Getpid())), 0)
+
+	unlock = func() {
+		_ = syscall.Flock(fd, syscall.LOCK_UN)
+		_ = file.Close()
+	}
+
+	return
+}
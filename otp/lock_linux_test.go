@@ -0,0 +1,234 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build linux
+
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// tempLockDir sets LockDir to a temporary directory for the test duration.
+func tempLockDir(t *testing.T) {
+	dir := LockDir
+	LockDir = t.TempDir()
+
+	t.Cleanup(func() { LockDir = dir })
+}
+
+func TestLockPath(t *testing.T) {
+	tempLockDir(t)
+
+	for devicePath, exp := range map[string]string{
+		"/sys/bus/nvmem/devices/imx-ocotp0/nvmem": "crucible-imx-ocotp0.lock",
+		"/tmp/nvmem.IMX6UL":                       "crucible-tmp-nvmem.IMX6UL.lock",
+	} {
+		if path := LockPath(devicePath); path != filepath.Join(LockDir, exp) {
+			t.Errorf("unexpected lock path for %s, %s != %s", devicePath, path, exp)
+		}
+	}
+}
+
+func TestLockBusy(t *testing.T) {
+	timeout := LockTimeout
+	defer func() { LockTimeout = timeout }()
+
+	tempLockDir(t)
+	LockTimeout = 50 * time.Millisecond
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+
+	if err = os.WriteFile(devicePath, make([]byte, 512), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockNVMEM(context.Background(), devicePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var busy *BusyError
+
+	_, _, _, _, err = ReadNVMEM(devicePath, f, "SRK_HASH")
+
+	if !errors.As(err, &busy) || busy.PID != os.Getpid() {
+		t.Errorf("reading a locked device should raise a BusyError with holder pid (%v)", err)
+	}
+
+	_, _, _, _, _, err = BlowNVMEM(devicePath, f, "SRK_LOCK", []byte{0x01})
+
+	if !errors.As(err, &busy) {
+		t.Errorf("blowing a locked device should raise a BusyError (%v)", err)
+	}
+
+	unlock()
+
+	if _, _, _, _, err = ReadNVMEM(devicePath, f, "SRK_HASH"); err != nil {
+		t.Errorf("reading an unlocked device should not raise an error (%v)", err)
+	}
+}
+
+func TestLockFile(t *testing.T) {
+	tempLockDir(t)
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+	target := filepath.Join(t.TempDir(), "target")
+
+	if err := os.WriteFile(target, []byte("target"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Symlink(target, LockPath(devicePath)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lockNVMEM(context.Background(), devicePath); err == nil {
+		t.Error("symbolic link lock file should raise an error")
+	}
+
+	if buf, _ := os.ReadFile(target); string(buf) != "target" {
+		t.Errorf("symbolic link target has been modified, %q", buf)
+	}
+
+	if err := os.Remove(LockPath(devicePath)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.Mkdir(LockPath(devicePath), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := lockNVMEM(context.Background(), devicePath); err == nil {
+		t.Error("non regular lock file should raise an error")
+	}
+
+	if err := os.Remove(LockPath(devicePath)); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := os.WriteFile(LockPath(devicePath), []byte("4194304\nstale\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	unlock, err := lockNVMEM(context.Background(), devicePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+
+	buf, _ := os.ReadFile(LockPath(devicePath))
+
+	if len(buf) != 14 || string(buf[:11]) != fmt.Sprintf("%10d\n", os.Getpid()) {
+		t.Errorf("unexpected lock file content, %q", buf)
+	}
+
+	if os.Geteuid() != 0 {
+		return
+	}
+
+	if err = os.Chown(LockPath(devicePath), 65534, 65534); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = lockNVMEM(context.Background(), devicePath); err == nil {
+		t.Error("lock file owned by another user should raise an error")
+	}
+}
+
+func TestLockFileShared(t *testing.T) {
+	tempLockDir(t)
+
+	for _, c := range []struct {
+		uid     int
+		gid     int
+		group   int
+		trusted bool
+	}{
+		{os.Geteuid(), 65534, -1, true},
+		{0, 65534, -1, true},
+		{65534, 1000, 1000, true},
+		{65534, 1000, -1, false},
+		{65534, 65534, 1000, false},
+	} {
+		if c.uid == os.Geteuid() && !c.trusted {
+			continue
+		}
+
+		if trustedLockOwner(c.uid, c.gid, c.group) != c.trusted {
+			t.Errorf("unexpected lock owner trust for %+v", c)
+		}
+	}
+
+	group, err := user.LookupGroupId(strconv.Itoa(os.Getegid()))
+
+	if err != nil {
+		t.Skip(err)
+	}
+
+	lockGroup := LockGroup
+	LockGroup = group.Name
+
+	defer func() {
+		LockGroup = lockGroup
+	}()
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+	unlock, err := lockNVMEM(context.Background(), devicePath)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	unlock()
+
+	stat, err := os.Stat(LockPath(devicePath))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if sys := stat.Sys().(*syscall.Stat_t); int(sys.Gid) != os.Getegid() || stat.Mode().Perm() != 0664 {
+		t.Errorf("lock file should be shared with the lock group (gid:%d mode:%v)", sys.Gid, stat.Mode())
+	}
+
+	if os.Geteuid() != 0 {
+		return
+	}
+
+	// lock file created by another lock group member
+	if err = os.Chown(LockPath(devicePath), 65534, os.Getegid()); err != nil {
+		t.Fatal(err)
+	}
+
+	if unlock, err = lockNVMEM(context.Background(), devicePath); err != nil {
+		t.Fatalf("lock file owned by the lock group should be accepted (%v)", err)
+	}
+
+	unlock()
+}
@@ -0,0 +1,476 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/util"
+)
+
+// MMIO represents a memory mapped OTP controller register file, offsets are
+// relative to the controller base address.
+type MMIO interface {
+	// Read returns a 32-bit register value
+	Read(off uint32) uint32
+	// Write sets a 32-bit register value
+	Write(off uint32, val uint32)
+}
+
+// Controller represents an OTP controller operated through direct register
+// access, OTP words are addressed by their index (bank * bank size + word).
+type Controller interface {
+	// WordSize returns the number of bytes per OTP word
+	WordSize() int
+	// ReadWord reads an OTP word
+	ReadWord(index int) (val uint32, err error)
+	// BlowWord fuses an OTP word
+	BlowWord(index int, val uint32) (err error)
+}
+
+// ShadowReloader is implemented by OTP controllers which support reloading
+// shadow registers, used for read operations, from OTP fuses without a reset.
+type ShadowReloader interface {
+	// ShadowReload reloads all shadow registers
+	ShadowReload() (err error)
+}
+
+// Sensor is implemented by OTP controllers which support reading OTP words
+// directly from fuses, bypassing shadow registers.
+type Sensor interface {
+	// SenseWord reads an OTP word from its fuses
+	SenseWord(index int) (val uint32, err error)
+}
+
+// DefaultTimeout is the default OTP controller operation timeout.
+const DefaultTimeout = 100 * time.Millisecond
+
+// NewController returns the OTP controller instance matching the fusemap
+// driver, operating on the argument register file.
+func NewController(f *fusemap.FuseMap, mmio MMIO) (ctrl Controller, err error) {
+	if mmio == nil {
+		return nil, errors.New("missing MMIO instance")
+	}
+
+	switch f.Driver {
+	case "nvmem-imx-ocotp":
+		// i.MX7 OCOTP programs fuses by bank, through OCOTP_DATA0-3, with
+		// different write timings
+		if f.Processor == "IMX7D" {
+			return nil, fmt.Errorf("%s does not support direct register access", f.Processor)
+		}
+
+		ctrl = &OCOTPController{MMIO: mmio, Gaps: shadowGaps(f)}
+	case "nvmem-imx-iim":
+		ctrl = &IIMController{MMIO: mmio}
+	case "nvmem-sunxi-sid":
+		ctrl = &SIDController{MMIO: mmio}
+	default:
+		err = fmt.Errorf("driver %s does not support direct register access", f.Driver)
+	}
+
+	return
+}
+
+// shadowGaps returns the fusemap read gaps, which reflect OCOTP shadow
+// register addressing gaps, indexed by the first OTP word index following
+// them.
+func shadowGaps(f *fusemap.FuseMap) (gaps map[int]int) {
+	for name, gap := range f.Gaps {
+		reg, ok := f.Registers[name]
+
+		if !ok || gap == nil || !gap.Read {
+			continue
+		}
+
+		if gaps == nil {
+			gaps = make(map[int]int)
+		}
+
+		gaps[f.Index(reg)] += gap.Length
+	}
+
+	return
+}
+
+// ControllerSize returns the register file size of the OTP controller
+// matching the fusemap driver.
+func ControllerSize(f *fusemap.FuseMap) (size int, err error) {
+	switch f.Driver {
+	case "nvmem-imx-ocotp":
+		size = ocotpSize
+	case "nvmem-imx-iim":
+		size = iimSize
+	case "nvmem-sunxi-sid":
+		size = sidSize
+	default:
+		err = fmt.Errorf("driver %s does not support direct register access", f.Driver)
+	}
+
+	return
+}
+
+// wait polls a register until the masked value matches, or the timeout
+// expires.
+func wait(mmio MMIO, off uint32, mask uint32, val uint32, timeout time.Duration) bool {
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+
+	deadline := time.Now().Add(timeout)
+
+	for mmio.Read(off)&mask != val {
+		if time.Now().After(deadline) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// mmioParams returns the first OTP word index, offset and bit length of a
+// register or fuse.
+func mmioParams(ctrl Controller, f *fusemap.FuseMap, name string) (index int, off int, bitLen int, err error) {
+	if !f.Valid() {
+		err = errors.New("fusemap has not been validated yet")
+		return
+	}
+
+	if ctrl == nil {
+		err = errors.New("missing controller instance")
+		return
+	}
+
+	if ctrl.WordSize() != f.WordSize {
+		err = errors.New("controller and fusemap word size mismatch")
+		return
+	}
+
+	mapping, err := f.Find(name)
+
+	if err != nil {
+		return
+	}
+
+	var reg *fusemap.Register
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		reg = m
+		bitLen = reg.Length
+	case *fusemap.Fuse:
+		reg = m.Register
+		off = m.Offset
+		bitLen = m.Length
+	}
+
+	index = f.Index(reg)
+
+	return
+}
+
+func putWord(buf []byte, val uint32) {
+	switch len(buf) {
+	case 1:
+		buf[0] = byte(val)
+	case 4:
+		binary.LittleEndian.PutUint32(buf, val)
+	}
+}
+
+func getWord(buf []byte) uint32 {
+	switch len(buf) {
+	case 1:
+		return uint32(buf[0])
+	case 4:
+		return binary.LittleEndian.Uint32(buf)
+	}
+
+	return 0
+}
+
+// ReadMMIO reads a fuse through direct OTP controller register access,
+// returns the value as well as the OTP word index, offset and bit length. The
+// name argument could be a register or an individual OTP fuse.
+//
+// Unlike ReadNVMEM() the OTP word index is not affected by fusemap gaps.
+func ReadMMIO(ctrl Controller, f *fusemap.FuseMap, name string) (res []byte, index uint32, off int, bitLen int, err error) {
+	return ReadMMIOContext(context.Background(), ctrl, f, name)
+}
+
+// ReadMMIOContext performs ReadMMIO() checking the argument context for
+// cancellation before each OTP word read.
+func ReadMMIOContext(ctx context.Context, ctrl Controller, f *fusemap.FuseMap, name string) (res []byte, index uint32, off int, bitLen int, err error) {
+	idx, off, bitLen, err := mmioParams(ctrl, f, name)
+
+	if err != nil {
+		return
+	}
+
+	index = uint32(idx)
+	val, err := readMMIO(ctx, ctrl, f, idx, off, bitLen)
+
+	if err != nil {
+		return nil, index, off, bitLen, err
+	}
+
+	res = util.ConvertReadValue(off, bitLen, val)
+
+	return
+}
+
+// ReadWordsMMIO reads all OTP words covered by a register or fuse through
+// direct OTP controller register access, returns their raw value, in index
+// order, as well as the first OTP word index.
+func ReadWordsMMIO(ctrl Controller, f *fusemap.FuseMap, name string) (words []byte, index uint32, err error) {
+	idx, off, bitLen, err := mmioParams(ctrl, f, name)
+
+	if err != nil {
+		return
+	}
+
+	index = uint32(idx)
+	words, err = readMMIO(context.Background(), ctrl, f, idx, off, bitLen)
+
+	return
+}
+
+// readMMIO reads all OTP words covered by a register or fuse, see
+// mmioParams() for arguments.
+func readMMIO(ctx context.Context, ctrl Controller, f *fusemap.FuseMap, index int, off int, bitLen int) (val []byte, err error) {
+	wordSize := f.WordSize
+	regSize := 8 * wordSize
+	numRegisters := (off + bitLen + regSize - 1) / regSize
+
+	val = make([]byte, numRegisters*wordSize)
+
+	for i := 0; i < numRegisters; i++ {
+		if err = ctx.Err(); err != nil {
+			return nil, &ReadError{
+				Address: uint32(index + i),
+				Read:    i,
+				Words:   numRegisters,
+				Err:     err,
+			}
+		}
+
+		w, err := ctrl.ReadWord(index + i)
+
+		if err != nil {
+			return nil, err
+		}
+
+		putWord(val[i*wordSize:(i+1)*wordSize], w)
+	}
+
+	return
+}
+
+// BlowMMIO fuses a register or fuse through direct OTP controller register
+// access, returns the input value converted as required for the fusing
+// operation as well as the first written OTP word index. The name argument
+// could be a register or an individual OTP fuse.
+//
+// The value parameter is interpreted as a big-endian value, with the same
+// semantics of BlowNVMEM().
+//
+// The outcome of each OTP word write is returned, multi-word write failures
+// are also reported with a *WriteError detailing which words have been
+// written.
+//
+// Writes to ECC protected words which already hold data are refused with an
+// *ECCError, writes to read-only registers are always refused.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func BlowMMIO(ctrl Controller, f *fusemap.FuseMap, name string, val []byte) (res []byte, index uint32, off int, bitLen int, words []Word, err error) {
+	return BlowMMIOContext(context.Background(), ctrl, f, name, val)
+}
+
+// BlowMMIOContext performs BlowMMIO() checking the argument context for
+// cancellation before each OTP word write. An OTP word write is never
+// interrupted, a cancelled multi-word operation is reported with a
+// *WriteError detailing which words have been written.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func BlowMMIOContext(ctx context.Context, ctrl Controller, f *fusemap.FuseMap, name string, val []byte) (res []byte, index uint32, off int, bitLen int, words []Word, err error) {
+	if len(val) == 0 {
+		err = errors.New("null value")
+		return
+	}
+
+	idx, off, bitLen, err := mmioParams(ctrl, f, name)
+
+	if err != nil {
+		return
+	}
+
+	index = uint32(idx)
+
+	if res, err = util.ConvertWriteValue(off, bitLen, val); err != nil {
+		return
+	}
+
+	wordSize := f.WordSize
+
+	if wordSize == 4 {
+		res = util.Pad4(res)
+	}
+
+	read := ctrl.ReadWord
+
+	// fuse bank registers might not reflect the current fuse state
+	if sensor, ok := ctrl.(Sensor); ok {
+		read = sensor.SenseWord
+	}
+
+	err = checkWrite(f, idx, len(res)/wordSize, func(i int) (addr uint32, cur []byte, err error) {
+		addr = index + uint32(i)
+		cur = make([]byte, wordSize)
+
+		w, err := read(idx + i)
+		putWord(cur, w)
+
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	words = make([]Word, 0, len(res)/wordSize)
+
+	for i := 0; i < len(res); i += wordSize {
+		words = append(words, Word{
+			Address: index + uint32(i/wordSize),
+			Value:   res[i : i+wordSize],
+		})
+	}
+
+	// write one complete OTP word at the time
+	for i, w := range words {
+		if werr := ctx.Err(); werr != nil {
+			words[i].Err = werr
+			return res, index, off, bitLen, words, &WriteError{Words: words}
+		}
+
+		if werr := ctrl.BlowWord(int(w.Address), getWord(w.Value)); werr != nil {
+			words[i].Err = werr
+			return res, index, off, bitLen, words, &WriteError{Words: words}
+		}
+
+		words[i].Written = true
+	}
+
+	return
+}
+
+// ShadowReload reloads the OTP controller shadow registers, an error is
+// returned if the controller does not support it (see ShadowReloader).
+func ShadowReload(ctrl Controller) (err error) {
+	r, ok := ctrl.(ShadowReloader)
+
+	if !ok {
+		return errors.New("controller does not support shadow reload")
+	}
+
+	return r.ShadowReload()
+}
+
+// Check represents the comparison between an OTP word shadow register and
+// its fuse value.
+type Check struct {
+	// Name is the register name
+	Name string
+	// Index is the OTP word index
+	Index uint32
+	// Shadow is the shadow register value
+	Shadow uint32
+	// Fuse is the sensed fuse value
+	Fuse uint32
+}
+
+// Diverged returns whether the shadow register and fuse values differ.
+func (c *Check) Diverged() bool {
+	return c.Shadow != c.Fuse
+}
+
+// CheckMMIO compares shadow register and sensed fuse values of all OTP words
+// covered by the argument register or fuse, or of all fusemap registers when
+// the name is empty. An error is returned if the controller does not support
+// sensing (see Sensor).
+//
+// A divergence indicates that shadow registers, which are also used by the
+// boot ROM and the kernel, have not been reloaded since fusing.
+func CheckMMIO(ctrl Controller, f *fusemap.FuseMap, name string) (checks []*Check, err error) {
+	sensor, ok := ctrl.(Sensor)
+
+	if !ok {
+		return nil, errors.New("controller does not support sensing")
+	}
+
+	names := make(map[int]string)
+
+	for _, reg := range f.Registers {
+		names[f.Index(reg)] = reg.Name
+	}
+
+	var indices []int
+
+	if name == "" {
+		for _, reg := range f.RegistersByReadAddress() {
+			indices = append(indices, f.Index(reg))
+		}
+	} else {
+		index, off, bitLen, err := mmioParams(ctrl, f, name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		regSize := 8 * f.WordSize
+
+		for i := 0; i < (off+bitLen+regSize-1)/regSize; i++ {
+			indices = append(indices, index+i)
+		}
+	}
+
+	for _, index := range indices {
+		c := &Check{
+			Name:  names[index],
+			Index: uint32(index),
+		}
+
+		if c.Shadow, err = ctrl.ReadWord(index); err != nil {
+			return
+		}
+
+		if c.Fuse, err = sensor.SenseWord(index); err != nil {
+			return
+		}
+
+		checks = append(checks, c)
+	}
+
+	return
+}
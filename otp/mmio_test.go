@@ -0,0 +1,567 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// ocotpModel is a register-level model of the NXP On-Chip OTP Controller.
+type ocotpModel struct {
+	t *testing.T
+
+	ctrl     uint32
+	timing   uint32
+	readData uint32
+	busy     int
+	stuck    bool
+	// i.MX6UL shadow registers gap between Bank5 Word7 (0x6f0) and Bank6
+	// Word0 (0x800)
+	gap bool
+
+	fuses  [ocotpShadowCount]uint32
+	shadow [ocotpShadowCount]uint32
+	locked map[uint32]bool
+}
+
+func (m *ocotpModel) Read(off uint32) uint32 {
+	switch {
+	case off == ocotpCtrl:
+		if m.stuck || m.busy > 0 {
+			m.busy--
+			return m.ctrl | ctrlBusy
+		}
+
+		// shadow reload completion
+		m.ctrl &^= ctrlReloadShadows
+
+		return m.ctrl
+	case off == ocotpTiming:
+		return m.timing
+	case off == ocotpReadData:
+		return m.readData
+	case m.gap && off >= 0x700 && off < 0x800:
+		m.t.Errorf("read from shadow registers gap %#x", off)
+		return 0
+	case m.gap && off >= 0x800 && off < ocotpSize:
+		return m.shadow[6*8+(off-0x800)/0x10]
+	case off >= ocotpShadow && off < ocotpShadow+ocotpShadowCount*0x10:
+		return m.shadow[(off-ocotpShadow)/0x10]
+	}
+
+	m.t.Errorf("read from unexpected register %#x", off)
+
+	return 0
+}
+
+func (m *ocotpModel) Write(off uint32, val uint32) {
+	if m.busy > 0 && off != ocotpCtrlClr {
+		m.t.Errorf("write to register %#x while busy", off)
+	}
+
+	switch off {
+	case ocotpCtrl:
+		m.ctrl = val
+	case ocotpCtrlSet:
+		m.ctrl |= val
+
+		if val&ctrlReloadShadows != 0 {
+			m.shadow = m.fuses
+			m.busy = 2
+		}
+	case ocotpCtrlClr:
+		m.ctrl &^= val
+	case ocotpTiming:
+		m.timing = val
+	case ocotpReadCtrl:
+		if val&readCtrlReadFuse != 0 {
+			m.readData = m.fuses[m.ctrl&ctrlAddrMask]
+			m.busy = 2
+		}
+	case ocotpData:
+		index := m.ctrl & ctrlAddrMask
+		m.busy = 3
+
+		if m.ctrl&ctrlError != 0 || m.ctrl&ctrlWrUnlockMask != ctrlWrUnlock || m.locked[index] {
+			m.ctrl |= ctrlError
+			return
+		}
+
+		// the unlock key is cleared on each write
+		m.ctrl &^= ctrlWrUnlockMask
+		m.fuses[index] |= val
+	default:
+		m.t.Errorf("write to unexpected register %#x", off)
+	}
+}
+
+// iimModel is a register-level model of the NXP IC Identification Module.
+type iimModel struct {
+	t *testing.T
+
+	stat  uint32
+	err   uint32
+	ua    uint32
+	la    uint32
+	sdat  uint32
+	pregP uint32
+
+	fuses [iimBankCount * iimWordCount]uint32
+	banks [iimBankCount * iimWordCount]uint32
+	prgd  int
+}
+
+func (m *iimModel) reset() {
+	m.banks = m.fuses
+}
+
+func (m *iimModel) Read(off uint32) uint32 {
+	switch {
+	case off == iimStat:
+		return m.stat
+	case off == iimErr:
+		return m.err
+	case off == iimSdat:
+		return m.sdat
+	case off >= iimBank && off < iimSize:
+		bank := (off - iimBank) / iimBankSize
+		word := (off - iimBank) % iimBankSize / 4
+
+		if word < iimWordCount {
+			return m.banks[bank*iimWordCount+word]
+		}
+	}
+
+	m.t.Errorf("read from unexpected register %#x", off)
+
+	return 0
+}
+
+func (m *iimModel) Write(off uint32, val uint32) {
+	switch off {
+	case iimStat:
+		m.stat &^= val
+	case iimErr:
+		m.err &^= val
+	case iimUA:
+		m.ua = val
+	case iimLA:
+		m.la = val
+	case iimPregP:
+		m.pregP = val
+	case iimFctl:
+		// UA[5:3] bank, UA[2:0] row[7:5], LA[7:3] row[4:0], LA[2:0] bit
+		bank := (m.ua >> 3) & 0x7
+		row := (m.ua&0x7)<<5 | (m.la>>3)&0x1f
+		bit := m.la & 0x7
+
+		if bank >= iimBankCount || row >= iimWordCount {
+			m.t.Errorf("operation on unexpected fuse address (bank:%d row:%d)", bank, row)
+			break
+		}
+
+		index := bank*iimWordCount + row
+
+		if val&fctlEsnsN != 0 {
+			m.sdat = m.fuses[index]
+			m.stat |= statSnsd
+		}
+
+		if val&fctlPrg == 0 {
+			break
+		}
+
+		if m.pregP != pregPUnlock {
+			// program protect error
+			m.err |= 1 << 6
+			m.stat |= statPrgd
+			break
+		}
+
+		m.fuses[index] |= 1 << bit
+		m.stat |= statPrgd
+		m.prgd += 1
+	default:
+		m.t.Errorf("write to unexpected register %#x", off)
+	}
+}
+
+// sidModel is a register-level model of the Allwinner Security ID, its memory
+// mapped eFuse window is not modeled as it might report stale values.
+type sidModel struct {
+	t *testing.T
+
+	prctl uint32
+	rdkey uint32
+
+	fuses [sidWordCount]uint32
+}
+
+func (m *sidModel) Read(off uint32) uint32 {
+	switch off {
+	case sidPrctl:
+		return m.prctl
+	case sidRdkey:
+		return m.rdkey
+	}
+
+	m.t.Errorf("read from unexpected register %#x", off)
+
+	return 0
+}
+
+func (m *sidModel) Write(off uint32, val uint32) {
+	switch off {
+	case sidPrctl:
+		m.prctl = val
+
+		if val&prctlRead != 0 && val&0xff00 == prctlOpLock {
+			m.rdkey = m.fuses[(val>>prctlOffsetShift&prctlOffsetMask)/4]
+			m.prctl &^= prctlRead
+		}
+	default:
+		m.t.Errorf("write to unexpected register %#x", off)
+	}
+}
+
+func TestOCOTPController(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &ocotpModel{t: t, locked: map[uint32]bool{0x23: true}}
+	ctrl, err := NewController(f, model)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, _, _, err = BlowMMIO(ctrl, f, "MAC1_ADDR[31:0]", []byte{0x10, 0x07, 0xe3}); err == nil || model.fuses[0x22] != 0 {
+		t.Fatal("write without clock rate should be refused")
+	}
+
+	ctrl.(*OCOTPController).ClockRate = 66000000
+
+	res, index, _, _, words, err := BlowMMIO(ctrl, f, "MAC1_ADDR[31:0]", []byte{0x10, 0x07, 0xe3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(words) != 1 || !words[0].Written || words[0].Address != 0x22 {
+		t.Errorf("unexpected word outcome, %+v", words)
+	}
+
+	if index != 0x22 || model.fuses[0x22] != 0x1007e3 || !bytes.Equal(res, []byte{0xe3, 0x07, 0x10, 0x00}) {
+		t.Errorf("unexpected fusing result (index:%#x fuse:%#x res:%x)", index, model.fuses[0x22], res)
+	}
+
+	if exp := uint32(6<<16 | 1<<12 | 663); model.timing != exp {
+		t.Errorf("unexpected timing %#x", model.timing)
+	}
+
+	res, _, _, _, err = ReadMMIO(ctrl, f, "MAC1_ADDR[31:0]")
+
+	if err != nil || !bytes.Equal(res, []byte{0x00, 0x10, 0x07, 0xe3}) {
+		t.Errorf("shadow registers should be reloaded after write (%x, %v)", res, err)
+	}
+
+	if words, index, err := ReadWordsMMIO(ctrl, f, "MAC1_ADDR"); err != nil || index != 0x22 || !bytes.Equal(words, []byte{0xe3, 0x07, 0x10, 0x00, 0x00, 0x00, 0x00, 0x00}) {
+		t.Errorf("unexpected raw words (%#x %x, %v)", index, words, err)
+	}
+
+	var werr *WriteError
+
+	if _, _, _, _, _, err = BlowMMIO(ctrl, f, "MAC1_ADDR", []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06}); !errors.As(err, &werr) {
+		t.Fatalf("write on locked word should raise a WriteError (%v)", err)
+	}
+
+	if werr.Written() != 1 || werr.Failed().Address != 0x23 {
+		t.Errorf("unexpected write error, %v", werr)
+	}
+
+	if model.ctrl&ctrlError != 0 {
+		t.Error("controller error should be cleared")
+	}
+
+	model.stuck = true
+
+	if _, _, _, _, err = ReadMMIO(ctrl, f, "MAC1_ADDR"); err == nil {
+		t.Error("busy controller should raise an error")
+	}
+}
+
+func TestOCOTPShadowGap(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &ocotpModel{t: t, gap: true}
+	ctrl, err := NewController(f, model)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// OCOTP_SRK_REVOKE (bank 5), OCOTP_GP30 (bank 8)
+	model.shadow[5*8+7] = 0x01
+	model.shadow[8*8+0] = 0xaabbccdd
+
+	if res, _, _, _, err := ReadMMIO(ctrl, f, "OCOTP_SRK_REVOKE"); err != nil || !bytes.Equal(res, []byte{0x00, 0x00, 0x00, 0x01}) {
+		t.Errorf("unexpected read value before gap (%x, %v)", res, err)
+	}
+
+	if res, _, _, _, err := ReadMMIO(ctrl, f, "OCOTP_GP30"); err != nil || !bytes.Equal(res, []byte{0xaa, 0xbb, 0xcc, 0xdd}) {
+		t.Errorf("unexpected read value after gap (%x, %v)", res, err)
+	}
+
+	model.fuses = model.shadow
+
+	checks, err := CheckMMIO(ctrl, f, "")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, c := range checks {
+		if c.Diverged() {
+			t.Errorf("unexpected divergence for %s (%#x != %#x)", c.Name, c.Shadow, c.Fuse)
+		}
+	}
+}
+
+func TestIIMController(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX53", "2.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &iimModel{t: t}
+	ctrl, err := NewController(f, model)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	val := []byte{0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07}
+
+	res, index, _, _, _, err := BlowMMIO(ctrl, f, "SJC_RESP", val)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if index != 34 || len(res) != 7 || res[0] != 0x07 {
+		t.Errorf("unexpected fusing result (index:%d res:%x)", index, res)
+	}
+
+	if model.prgd != 12 || model.pregP != 0 {
+		t.Errorf("unexpected programming operations (prgd:%d preg_p:%#x)", model.prgd, model.pregP)
+	}
+
+	// SJC_RESP starts at bank 1, row 2
+	if model.fuses[1*iimWordCount+2] != 0x07 {
+		t.Errorf("fuses programmed in unexpected bank or row")
+	}
+
+	for i, val := range model.fuses[:iimWordCount] {
+		if val != 0 {
+			t.Errorf("unexpected bank 0 fuses programming (row:%d val:%#x)", i, val)
+		}
+	}
+
+	if res, _, _, _, _ = ReadMMIO(ctrl, f, "SJC_RESP"); !bytes.Equal(res, make([]byte, 7)) {
+		t.Errorf("fuse bank registers should not be updated before reset (%x)", res)
+	}
+
+	model.reset()
+
+	if res, _, _, _, _ = ReadMMIO(ctrl, f, "SJC_RESP"); !bytes.Equal(res, val) {
+		t.Errorf("unexpected read value, %x != %x", res, val)
+	}
+
+	if err = ctrl.BlowWord(0, 0x100); err == nil {
+		t.Error("IIM word write exceeding 8 bits should raise an error")
+	}
+}
+
+func TestCheckMMIO(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX53", "2.1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &iimModel{t: t}
+	ctrl, _ := NewController(f, model)
+
+	if err = ShadowReload(ctrl); err == nil {
+		t.Error("IIM shadow reload should not be supported")
+	}
+
+	if _, _, _, _, _, err = BlowMMIO(ctrl, f, "SJC_RESP", []byte{0x01, 0x00}); err != nil {
+		t.Fatal(err)
+	}
+
+	checks, err := CheckMMIO(ctrl, f, "SJC_RESP")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checks) != 7 || !checks[1].Diverged() || checks[1].Fuse != 0x01 || checks[1].Shadow != 0x00 {
+		t.Errorf("fused word should diverge from its shadow before reset")
+	}
+
+	for i, c := range checks {
+		if i != 1 && c.Diverged() {
+			t.Errorf("unexpected divergence at %d", c.Index)
+		}
+	}
+
+	model.reset()
+
+	if checks, err = CheckMMIO(ctrl, f, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checks) != len(f.Registers) {
+		t.Errorf("unexpected number of checks, %d != %d", len(checks), len(f.Registers))
+	}
+
+	for _, c := range checks {
+		if c.Diverged() {
+			t.Errorf("unexpected divergence at %s", c.Name)
+		}
+	}
+}
+
+func TestOCOTPShadowReload(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &ocotpModel{t: t}
+	ctrl, _ := NewController(f, model)
+
+	// simulate fusing by another agent
+	model.fuses[0x22] = 0xaabbccdd
+
+	checks, err := CheckMMIO(ctrl, f, "OCOTP_MAC0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(checks) != 1 || !checks[0].Diverged() || checks[0].Name != "OCOTP_MAC0" {
+		t.Fatal("fused word should diverge from its shadow before reload")
+	}
+
+	if err = ShadowReload(ctrl); err != nil {
+		t.Fatal(err)
+	}
+
+	if checks, _ = CheckMMIO(ctrl, f, "OCOTP_MAC0"); checks[0].Diverged() {
+		t.Error("fused word should match its shadow after reload")
+	}
+}
+
+func TestBlowMMIOECC(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX8MP", "0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &ocotpModel{t: t}
+	ctrl, _ := NewController(f, model)
+	ctrl.(*OCOTPController).ClockRate = 66000000
+
+	if _, _, _, _, _, err = BlowMMIO(ctrl, f, "MAC_0_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var eccErr *ECCError
+
+	if _, _, _, _, _, err = BlowMMIO(ctrl, f, "MAC_1_ADDR[15:0]", []byte{0x01}); !errors.As(err, &eccErr) || eccErr.Address != 37 {
+		t.Errorf("partial write on fused ECC word should raise an ECCError (%v)", err)
+	}
+
+	if model.fuses[37] != 0x001f {
+		t.Errorf("refused ECC write should not alter fuses (%#x)", model.fuses[37])
+	}
+}
+
+func TestSIDController(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "H3", "1.2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	model := &sidModel{t: t}
+	model.fuses[13] = 0x0800081e
+
+	ctrl, err := NewController(f, model)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, index, _, _, err := ReadMMIO(ctrl, f, "THS_CALIBRATION")
+
+	if err != nil || index != 13 || !bytes.Equal(res, []byte{0x08, 0x00, 0x08, 0x1e}) {
+		t.Errorf("unexpected read value (%x, %v)", res, err)
+	}
+
+	if model.prctl != 0 {
+		t.Error("read operation should be cleared")
+	}
+
+	if _, _, _, _, _, err = BlowMMIO(ctrl, f, "THS_CALIBRATION", []byte{0x01}); err == nil {
+		t.Error("SID programming should raise an error")
+	}
+
+	if _, err = CheckMMIO(ctrl, f, ""); err == nil {
+		t.Error("SID sensing should not be supported")
+	}
+}
+
+func TestInvalidController(t *testing.T) {
+	f := &fusemap.FuseMap{Driver: "invalid"}
+
+	if _, err := NewController(f, &ocotpModel{t: t}); err == nil {
+		t.Error("unsupported driver should raise an error")
+	}
+
+	if _, err := NewController(f, nil); err == nil {
+		t.Error("missing MMIO should raise an error")
+	}
+
+	f, err := fusemap.Find(fusemaps, "IMX7D", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = NewController(f, &ocotpModel{t: t}); err == nil {
+		t.Error("i.MX7D banked OCOTP should raise an error")
+	}
+}
@@ -0,0 +1,126 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/util"
+)
+
+// readParams returns the read address, offset and bit length of a register
+// or fuse.
+func readParams(f *fusemap.FuseMap, name string) (addr uint32, off int, bitLen int, err error) {
+	if !f.Valid() {
+		err = errors.New("fusemap has not been validated yet")
+		return
+	}
+
+	mapping, err := f.Find(name)
+
+	if err != nil {
+		return
+	}
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		reg := m
+		addr = reg.ReadAddress
+		off = 0
+		bitLen = 8 * f.WordSize
+	case *fusemap.Fuse:
+		fuse := m
+		addr = fuse.Register.ReadAddress
+		off = fuse.Offset
+		bitLen = fuse.Length
+	}
+
+	return
+}
+
+// readWords reads OTP words from an NVMEM image, one at a time, checking the
+// argument context for cancellation before each word read. Short reads are
+// zero padded.
+func readWords(ctx context.Context, r io.ReaderAt, addr uint32, val []byte, wordSize int) (err error) {
+	for i := 0; i < len(val); i += wordSize {
+		if err = ctx.Err(); err != nil {
+			return &ReadError{
+				Address: addr + uint32(i),
+				Read:    i / wordSize,
+				Words:   len(val) / wordSize,
+				Err:     err,
+			}
+		}
+
+		n, err := r.ReadAt(val[i:i+wordSize], int64(addr)+int64(i))
+
+		if err == io.EOF && i+n > 0 {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return
+}
+
+// readRaw reads all OTP words covered by a register or fuse from an NVMEM
+// image (e.g. a device or its raw copy), see readParams() for arguments.
+func readRaw(ctx context.Context, r io.ReaderAt, f *fusemap.FuseMap, addr uint32, off int, bitLen int) (val []byte, err error) {
+	regSize := 8 * f.WordSize
+	numRegisters := 1 + (off+bitLen)/regSize
+
+	// normalize
+	if (off+bitLen)%regSize == 0 {
+		numRegisters -= 1
+	}
+
+	val = make([]byte, numRegisters*f.WordSize)
+	err = readWords(ctx, r, addr, val, f.WordSize)
+
+	return
+}
+
+// readNVMEM reads a register or fuse from an NVMEM image (e.g. a device or
+// its raw copy), see readParams() for arguments.
+func readNVMEM(ctx context.Context, r io.ReaderAt, f *fusemap.FuseMap, addr uint32, off int, bitLen int) (res []byte, err error) {
+	val, err := readRaw(ctx, r, f, addr, off, bitLen)
+
+	if err != nil {
+		return
+	}
+
+	res = util.ConvertReadValue(off, bitLen, val)
+
+	return
+}
+
+// DecodeWords converts the raw OTP words covered by a register or fuse, as
+// returned by ReadWordsNVMEM() and its variants, to the register or fuse value
+// with the same semantics of ReadNVMEM().
+func DecodeWords(f *fusemap.FuseMap, name string, words []byte) (res []byte, off int, bitLen int, err error) {
+	if _, off, bitLen, err = readParams(f, name); err != nil {
+		return
+	}
+
+	if need := (off + bitLen + 8*f.WordSize - 1) / (8 * f.WordSize) * f.WordSize; len(words) < need {
+		return nil, off, bitLen, fmt.Errorf("insufficient words (%d < %d bytes)", len(words), need)
+	}
+
+	res = util.ConvertReadValue(off, bitLen, slices.Clone(words))
+
+	return
+}
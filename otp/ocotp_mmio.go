@@ -0,0 +1,240 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// NXP On-Chip OTP Controller registers
+const (
+	ocotpCtrl     = 0x0000
+	ocotpCtrlSet  = 0x0004
+	ocotpCtrlClr  = 0x0008
+	ocotpTiming   = 0x0010
+	ocotpData     = 0x0020
+	ocotpReadCtrl = 0x0030
+	ocotpReadData = 0x0040
+	ocotpShadow   = 0x0400
+
+	ctrlWrUnlock      = 0x3e77 << 16
+	ctrlWrUnlockMask  = 0xffff << 16
+	ctrlReloadShadows = 1 << 10
+	ctrlError         = 1 << 9
+	ctrlBusy          = 1 << 8
+	ctrlAddrMask      = 0xff
+
+	readCtrlReadFuse = 1 << 0
+
+	// timing parameters (ns)
+	ocotpRelax       = 20
+	ocotpStrobeRead  = 40
+	ocotpStrobeProg  = 10000
+	ocotpTimingWait  = 0x0fc00000
+	ocotpPostamble   = 2 * time.Microsecond
+	ocotpShadowCount = 256
+
+	ocotpSize = 0x1000
+)
+
+// OCOTPController represents an NXP On-Chip OTP Controller (OCOTP), as found
+// on i.MX6 and i.MX8M series processors, operated through direct register
+// access.
+//
+// Fuses are written through the OCOTP_DATA register, while reads are served
+// by shadow registers which are reloaded after each write. Fuse values can be
+// sensed directly, bypassing shadow registers, with SenseWord().
+type OCOTPController struct {
+	// MMIO is the controller register file
+	MMIO MMIO
+	// ClockRate is the controller clock (ipg_clk) rate in Hz, it is used to
+	// program write timings and is therefore required by BlowWord.
+	ClockRate uint64
+	// Timeout is the operation timeout, DefaultTimeout is used when zero.
+	Timeout time.Duration
+	// Gaps holds shadow register addressing gaps (e.g. after bank 5 on
+	// i.MX6UL), in bytes, indexed by the first OTP word index following
+	// them (see fusemap.Gap).
+	Gaps map[int]int
+}
+
+// WordSize returns the number of bytes per OTP word.
+func (hw *OCOTPController) WordSize() int {
+	return 4
+}
+
+// clearError waits for the controller to be idle and clears any previous
+// operation error.
+func (hw *OCOTPController) clearError() (err error) {
+	if !wait(hw.MMIO, ocotpCtrl, ctrlBusy, 0, hw.Timeout) {
+		return errors.New("OCOTP controller busy")
+	}
+
+	if hw.MMIO.Read(ocotpCtrl)&ctrlError != 0 {
+		hw.MMIO.Write(ocotpCtrlClr, ctrlError)
+	}
+
+	return
+}
+
+// checkOp waits for an operation completion and reports its failure.
+func (hw *OCOTPController) checkOp() (err error) {
+	if !wait(hw.MMIO, ocotpCtrl, ctrlBusy, 0, hw.Timeout) {
+		return errors.New("OCOTP operation timeout")
+	}
+
+	if hw.MMIO.Read(ocotpCtrl)&ctrlError != 0 {
+		hw.MMIO.Write(ocotpCtrlClr, ctrlError)
+		return errors.New("OCOTP operation error (locked word?)")
+	}
+
+	return
+}
+
+// setTiming programs write timings according to the controller clock rate.
+func (hw *OCOTPController) setTiming() {
+	if hw.ClockRate == 0 {
+		return
+	}
+
+	rate := hw.ClockRate
+
+	// cycles, rounded up, for each timing parameter
+	relax := (rate*ocotpRelax+1e9-1)/1e9 - 1
+	strobeRead := (rate*ocotpStrobeRead+1e9-1)/1e9 + 2*(relax+1) - 1
+	strobeProg := (rate*ocotpStrobeProg+1e9-1)/1e9 + 2*(relax+1) - 1
+
+	timing := hw.MMIO.Read(ocotpTiming) & ocotpTimingWait
+	timing |= uint32(strobeProg) & 0xfff
+	timing |= uint32(relax<<12) & 0xf000
+	timing |= uint32(strobeRead<<16) & 0x3f0000
+
+	hw.MMIO.Write(ocotpTiming, timing)
+}
+
+func (hw *OCOTPController) checkIndex(index int) error {
+	if index < 0 || index >= ocotpShadowCount {
+		return fmt.Errorf("invalid OTP word index %d", index)
+	}
+
+	return nil
+}
+
+// ReadWord reads an OTP word from its shadow register.
+func (hw *OCOTPController) ReadWord(index int) (val uint32, err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	if err = hw.clearError(); err != nil {
+		return
+	}
+
+	return hw.MMIO.Read(hw.shadowOffset(index)), nil
+}
+
+// shadowOffset returns the shadow register offset of an OTP word, accounting
+// for addressing gaps.
+func (hw *OCOTPController) shadowOffset(index int) uint32 {
+	off := ocotpShadow + uint32(index)*0x10
+
+	for first, length := range hw.Gaps {
+		if index >= first {
+			off += uint32(length)
+		}
+	}
+
+	return off
+}
+
+// BlowWord fuses an OTP word, shadow registers are reloaded after the write
+// operation.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func (hw *OCOTPController) BlowWord(index int, val uint32) (err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	if hw.ClockRate == 0 {
+		return errors.New("OCOTP clock rate is required to program write timings")
+	}
+
+	if err = hw.clearError(); err != nil {
+		return
+	}
+
+	hw.setTiming()
+
+	ctrl := hw.MMIO.Read(ocotpCtrl)
+	ctrl &^= ctrlWrUnlockMask | ctrlAddrMask
+	ctrl |= ctrlWrUnlock | uint32(index)
+
+	hw.MMIO.Write(ocotpCtrl, ctrl)
+	hw.MMIO.Write(ocotpData, val)
+
+	if err = hw.checkOp(); err != nil {
+		return
+	}
+
+	// write postamble
+	time.Sleep(ocotpPostamble)
+
+	return hw.ShadowReload()
+}
+
+// ShadowReload reloads all shadow registers from OTP fuses.
+func (hw *OCOTPController) ShadowReload() (err error) {
+	if err = hw.clearError(); err != nil {
+		return
+	}
+
+	hw.setTiming()
+	hw.MMIO.Write(ocotpCtrlSet, ctrlReloadShadows)
+
+	if !wait(hw.MMIO, ocotpCtrl, ctrlBusy|ctrlReloadShadows, 0, hw.Timeout) {
+		return errors.New("OCOTP shadow reload timeout")
+	}
+
+	return hw.checkOp()
+}
+
+// SenseWord reads an OTP word directly from its fuses, bypassing its shadow
+// register.
+func (hw *OCOTPController) SenseWord(index int) (val uint32, err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	if err = hw.clearError(); err != nil {
+		return
+	}
+
+	hw.setTiming()
+
+	ctrl := hw.MMIO.Read(ocotpCtrl)
+	ctrl &^= ctrlWrUnlockMask | ctrlAddrMask
+	ctrl |= uint32(index)
+
+	hw.MMIO.Write(ocotpCtrl, ctrl)
+	hw.MMIO.Write(ocotpReadCtrl, readCtrlReadFuse)
+
+	if err = hw.checkOp(); err != nil {
+		return
+	}
+
+	return hw.MMIO.Read(ocotpReadData), nil
+}
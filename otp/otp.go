@@ -16,3 +16,123 @@
 //
 // The use of this package is therefore **at your own risk**.
 package otp
+
+import (
+	"fmt"
+	"math/big"
+)
+
+// Warning is the disclaimer shown before fusing operations.
+const Warning = `
+████████████████████████████████████████████████████████████████████████████████
+
+                                **  WARNING  **
+
+Fusing SoC OTPs is an **irreversible** action that permanently fuses values on
+the device. This means that any errors in the process, or lost fused data such
+as cryptographic key material, might result in a **bricked** device.
+
+The use of this tool is therefore **at your own risk**.
+
+████████████████████████████████████████████████████████████████████████████████
+`
+
+// CriticalWarning is the disclaimer shown before fusing critical registers or
+// fuses (see fusemap.FuseMap.Critical()).
+const CriticalWarning = `
+                            **  CRITICAL FUSE  **
+
+The following fuses are marked as critical, fusing them permanently changes
+the device security or boot configuration (e.g. enabling secure boot or
+disabling debug access), which cannot be reverted.
+`
+
+// CriticalConfirmation returns the text to be typed to confirm fusing a value
+// on a critical register or fuse, repeating its name and value.
+func CriticalConfirmation(name string, val []byte) string {
+	return fmt.Sprintf("%s %#x", name, new(big.Int).SetBytes(val))
+}
+
+// Word represents the outcome of a single OTP word write within a fusing
+// operation.
+type Word struct {
+	// Address is the NVMEM write address or, for OCOTP operations, the
+	// word index (bank * ocotp.BankSize + word).
+	Address uint32
+	// Value is the word value, in write order (little-endian)
+	Value []byte
+	// Written indicates whether the word write completed
+	Written bool
+	// Err is the word write error, if any
+	Err error
+}
+
+// WriteError represents a fusing operation interrupted by an OTP word write
+// failure, it reports the outcome of each word of the operation. Operations
+// stop at the first failure, words following the failed one are never
+// attempted.
+type WriteError struct {
+	Words []Word
+}
+
+// Failed returns the failed word.
+func (e *WriteError) Failed() (w *Word) {
+	for i := range e.Words {
+		if e.Words[i].Err != nil {
+			return &e.Words[i]
+		}
+	}
+
+	return
+}
+
+// Written returns the number of completed word writes.
+func (e *WriteError) Written() (n int) {
+	for _, w := range e.Words {
+		if w.Written {
+			n += 1
+		}
+	}
+
+	return
+}
+
+func (e *WriteError) Error() string {
+	w := e.Failed()
+
+	if w == nil {
+		return "word write failed"
+	}
+
+	return fmt.Sprintf("word write failed at %#x (%d/%d words written), %v", w.Address, e.Written(), len(e.Words), w.Err)
+}
+
+func (e *WriteError) Unwrap() error {
+	if w := e.Failed(); w != nil {
+		return w.Err
+	}
+
+	return nil
+}
+
+// ReadError represents a read operation interrupted before completion, it
+// reports how many OTP words have been read.
+type ReadError struct {
+	// Address is the NVMEM read address or, for OCOTP operations, the
+	// word index (bank * ocotp.BankSize + word) of the first unread word.
+	Address uint32
+	// Read is the number of words read
+	Read int
+	// Words is the number of words of the operation
+	Words int
+	// Err is the interruption cause
+	Err error
+}
+
+func (e *ReadError) Error() string {
+	return fmt.Sprintf("word read interrupted at %#x (%d/%d words read), %v", e.Address, e.Read, e.Words, e.Err)
+}
+
+func (e *ReadError) Unwrap() error {
+	return e.Err
+}
@@ -11,8 +11,12 @@
 package otp
 
 import (
+	"context"
 	"errors"
+	"fmt"
+	"io"
 	"os"
+	"time"
 
 	"github.com/usbarmory/crucible/fusemap"
 	"github.com/usbarmory/crucible/util"
@@ -29,13 +33,41 @@ import (
 // certain tools, such as the ones creating the `SRK_HASH` for secure boot
 // purposes, typically prepare their output in little-endian format.
 //
+// The outcome of each OTP word write is returned, multi-word write failures
+// are also reported with a *WriteError detailing which words have been
+// written.
+//
+// Writes to ECC protected words which already hold data are refused with an
+// *ECCError, writes to read-only registers are always refused.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (res []byte, addr uint32, off int, bitLen int, words []Word, err error) {
+	return blowNVMEM(context.Background(), devicePath, f, name, val, nil)
+}
+
+// BlowNVMEMContext performs BlowNVMEM() checking the argument context for
+// cancellation before each OTP word write. An OTP word write is never
+// interrupted, a cancelled multi-word operation is reported with a
+// *WriteError detailing which words have been written.
+//
 // WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
 // fuses values on the device. This means that any errors in the process, or
 // lost fused data such as cryptographic key material, might result in a
 // **bricked** device.
 //
 // The use of this function is therefore **at your own risk**.
-func BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (res []byte, addr uint32, off int, bitLen int, err error) {
+func BlowNVMEMContext(ctx context.Context, devicePath string, f *fusemap.FuseMap, name string, val []byte) (res []byte, addr uint32, off int, bitLen int, words []Word, err error) {
+	return blowNVMEM(ctx, devicePath, f, name, val, nil)
+}
+
+func blowNVMEM(ctx context.Context, devicePath string, f *fusemap.FuseMap, name string, val []byte, j *Journal) (res []byte, addr uint32, off int, bitLen int, words []Word, err error) {
+	var raddr uint32
+
 	if len(val) == 0 {
 		err = errors.New("null value")
 		return
@@ -46,7 +78,7 @@ func BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (
 		return
 	}
 
-	if f.Driver != "nvmem-imx-ocotp" {
+	if !f.Writable() {
 		err = errors.New("driver does not support blow operation")
 		return
 	}
@@ -57,18 +89,19 @@ func BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (
 		return
 	}
 
-	if err != nil {
-		return
-	}
+	var reg *fusemap.Register
 
 	switch m := mapping.(type) {
 	case *fusemap.Register:
-		reg := m
+		reg = m
+		raddr = reg.ReadAddress
 		addr = reg.WriteAddress
 		off = 0
 		bitLen = reg.Length
 	case *fusemap.Fuse:
 		fuse := m
+		reg = fuse.Register
+		raddr = fuse.Register.ReadAddress
 		addr = fuse.Register.WriteAddress
 		off = fuse.Offset
 		bitLen = fuse.Length
@@ -86,25 +119,102 @@ func BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (
 		return
 	}
 
+	unlock, err := lockNVMEM(ctx, devicePath)
+
+	if err != nil {
+		return
+	}
+	defer unlock()
+
+	if err = checkNVMEM(devicePath, f, reg, raddr, len(res)/f.WordSize); err != nil {
+		return
+	}
+
 	device, err := os.OpenFile(devicePath, os.O_WRONLY|os.O_EXCL|os.O_SYNC, 0600)
 
 	if err != nil {
 		return
 	}
+	// make errcheck happy
+	defer func() { _ = device.Close() }()
+
+	if j != nil {
+		if err = j.begin(devicePath, f, name, raddr, addr, res); err != nil {
+			return
+		}
+
+		defer func() { err = j.end(err) }()
+	}
+
+	words = make([]Word, 0, len(res)/f.WordSize)
 
-	// nvmem-imx-ocotp allows only one complete OTP word write at a time
 	for i := 0; i < len(res); i += f.WordSize {
-		_, err = device.Seek(int64(addr)+int64(i), 0)
+		words = append(words, Word{
+			Address: addr + uint32(i),
+			Value:   res[i : i+f.WordSize],
+		})
+	}
+
+	// NVMEM OTP drivers allow only one complete OTP word write at a time
+	for i, w := range words {
+		if werr := ctx.Err(); werr != nil {
+			words[i].Err = werr
+			err = &WriteError{Words: words}
+			return
+		}
+
+		if werr := writeWord(device, j, w.Address, w.Value); werr != nil {
+			words[i].Err = werr
+			err = &WriteError{Words: words}
+			return
+		}
+
+		words[i].Written = true
+	}
+
+	return
+}
+
+// checkNVMEM verifies that read-only words are not fused and that ECC
+// protected words are not fused twice, see ECCError.
+func checkNVMEM(devicePath string, f *fusemap.FuseMap, reg *fusemap.Register, raddr uint32, n int) (err error) {
+	var device *os.File
 
-		if err != nil {
+	defer func() {
+		if device != nil {
 			_ = device.Close()
+		}
+	}()
+
+	return checkWrite(f, f.Index(reg), n, func(i int) (addr uint32, val []byte, err error) {
+		if device == nil {
+			if device, err = os.Open(devicePath); err != nil {
+				return
+			}
+		}
+
+		addr = raddr + uint32(i*f.WordSize)
+		val = make([]byte, f.WordSize)
+		_, err = device.ReadAt(val, int64(addr))
+
+		return
+	})
+}
+
+func writeWord(device io.WriterAt, j *Journal, addr uint32, val []byte) (err error) {
+	if j != nil {
+		if err = j.record(&JournalRecord{Op: JournalWrite, WriteAddress: addr, Value: val}); err != nil {
 			return
 		}
+	}
 
-		_, err = device.Write(res[i : i+f.WordSize])
+	if _, err = device.WriteAt(val, int64(addr)); err != nil {
+		return
 	}
 
-	_ = device.Close()
+	if j != nil {
+		err = j.record(&JournalRecord{Op: JournalWritten, WriteAddress: addr, Value: val})
+	}
 
 	return
 }
@@ -112,36 +222,66 @@ func BlowNVMEM(devicePath string, f *fusemap.FuseMap, name string, val []byte) (
 // ReadNVMEM reads a register or fuse through Linux NVMEM subsystem framework.
 // The name argument could be a register or an individual OTP fuse.
 func ReadNVMEM(devicePath string, f *fusemap.FuseMap, name string) (res []byte, addr uint32, off int, bitLen int, err error) {
+	return ReadNVMEMContext(context.Background(), devicePath, f, name)
+}
+
+// ReadNVMEMContext performs ReadNVMEM() checking the argument context for
+// cancellation before each OTP word read. A cancelled multi-word operation is
+// reported with a *ReadError detailing how many words have been read.
+func ReadNVMEMContext(ctx context.Context, devicePath string, f *fusemap.FuseMap, name string) (res []byte, addr uint32, off int, bitLen int, err error) {
 	if devicePath == "" {
 		err = errors.New("empty device path")
 		return
 	}
 
-	if !f.Valid() {
-		err = errors.New("fusemap has not been validated yet")
+	addr, off, bitLen, err = readParams(f, name)
+
+	if err != nil {
 		return
 	}
 
-	mapping, err := f.Find(name)
+	unlock, err := lockNVMEM(ctx, devicePath)
 
 	if err != nil {
 		return
 	}
+	defer unlock()
 
-	regSize := 8 * f.WordSize
+	device, err := os.OpenFile(devicePath, os.O_RDONLY|os.O_EXCL|os.O_SYNC, 0600)
 
-	switch m := mapping.(type) {
-	case *fusemap.Register:
-		reg := m
-		addr = reg.ReadAddress
-		off = 0
-		bitLen = regSize
-	case *fusemap.Fuse:
-		fuse := m
-		addr = fuse.Register.ReadAddress
-		off = fuse.Offset
-		bitLen = fuse.Length
+	if err != nil {
+		return
 	}
+	// make errcheck happy
+	defer func() { _ = device.Close() }()
+
+	res, err = readNVMEM(ctx, device, f, addr, off, bitLen)
+
+	return
+}
+
+// ReadWordsNVMEM reads all OTP words covered by a register or fuse through
+// Linux NVMEM subsystem framework, returns their raw value, in device order,
+// as well as the read address.
+func ReadWordsNVMEM(devicePath string, f *fusemap.FuseMap, name string) (words []byte, addr uint32, err error) {
+	if devicePath == "" {
+		err = errors.New("empty device path")
+		return
+	}
+
+	addr, off, bitLen, err := readParams(f, name)
+
+	if err != nil {
+		return
+	}
+
+	ctx := context.Background()
+	unlock, err := lockNVMEM(ctx, devicePath)
+
+	if err != nil {
+		return
+	}
+	defer unlock()
 
 	device, err := os.OpenFile(devicePath, os.O_RDONLY|os.O_EXCL|os.O_SYNC, 0600)
 
@@ -151,27 +291,73 @@ func ReadNVMEM(devicePath string, f *fusemap.FuseMap, name string) (res []byte,
 	// make errcheck happy
 	defer func() { _ = device.Close() }()
 
-	_, err = device.Seek(int64(addr), 0)
+	words, err = readRaw(ctx, device, f, addr, off, bitLen)
+
+	return
+}
+
+// SnapshotNVMEM returns a snapshot of all OTP fuses exposed through Linux
+// NVMEM subsystem framework, see Snapshot.Read() for its offline decoding.
+func SnapshotNVMEM(devicePath string, f *fusemap.FuseMap) (s *Snapshot, err error) {
+	return SnapshotNVMEMContext(context.Background(), devicePath, f)
+}
+
+// SnapshotNVMEMContext performs SnapshotNVMEM() checking the argument context
+// for cancellation before each OTP word read. A cancelled operation is
+// reported with a *ReadError detailing how many words have been read.
+func SnapshotNVMEMContext(ctx context.Context, devicePath string, f *fusemap.FuseMap) (s *Snapshot, err error) {
+	if devicePath == "" {
+		return nil, errors.New("empty device path")
+	}
+
+	if !f.Valid() {
+		return nil, errors.New("fusemap has not been validated yet")
+	}
+
+	unlock, err := lockNVMEM(ctx, devicePath)
 
 	if err != nil {
 		return
 	}
+	defer unlock()
 
-	numRegisters := 1 + (off+bitLen)/regSize
+	device, err := os.OpenFile(devicePath, os.O_RDONLY|os.O_EXCL|os.O_SYNC, 0600)
 
-	// normalize
-	if (off+bitLen)%regSize == 0 {
-		numRegisters -= 1
+	if err != nil {
+		return
 	}
+	// make errcheck happy
+	defer func() { _ = device.Close() }()
 
-	val := make([]byte, numRegisters*f.WordSize)
-	_, err = device.Read(val)
+	stat, err := device.Stat()
 
 	if err != nil {
 		return
 	}
 
-	res = util.ConvertReadValue(off, bitLen, val)
+	words := make([]byte, stat.Size()-stat.Size()%int64(f.WordSize))
+
+	if err = readWords(ctx, device, 0, words, f.WordSize); err != nil {
+		return
+	}
+
+	s = &Snapshot{
+		Processor: f.Processor,
+		Reference: f.Reference,
+		Device:    devicePath,
+		Time:      time.Now().UTC(),
+		Words:     words,
+	}
+
+	if f.UniqueID != "" {
+		var uid []byte
+
+		if uid, _, _, _, err = s.Read(f, f.UniqueID); err != nil {
+			return nil, err
+		}
+
+		s.UniqueID = fmt.Sprintf("%#x", uid)
+	}
 
 	return
 }
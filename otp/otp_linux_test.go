@@ -12,6 +12,10 @@ package otp
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -19,15 +23,24 @@ import (
 	"github.com/usbarmory/crucible/fusemap"
 )
 
-var fusemaps = os.DirFS("../fusemaps")
-
 func blowTest(t *testing.T, f *fusemap.FuseMap, path string, name string, val []byte, expRes []byte, expAddr uint32) {
-	res, addr, _, _, err := BlowNVMEM(path, f, name, val)
+	res, addr, _, _, words, err := BlowNVMEM(path, f, name, val)
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	// no words are written without device
+	if path != "" && len(words) != len(res)/f.WordSize {
+		t.Errorf("blown register %s with unexpected number of words, %d", name, len(words))
+	}
+
+	for i, w := range words {
+		if !w.Written || w.Err != nil || w.Address != addr+uint32(i*f.WordSize) {
+			t.Errorf("blown register %s with unexpected word outcome, %+v", name, w)
+		}
+	}
+
 	if !bytes.Equal(res, expRes) {
 		t.Errorf("blown register %s with unexpected value, %x != %x", name, res, expRes)
 	}
@@ -38,9 +51,11 @@ func blowTest(t *testing.T, f *fusemap.FuseMap, path string, name string, val []
 }
 
 func TestInvalidFuseMap(t *testing.T) {
+	tempLockDir(t)
+
 	f := &fusemap.FuseMap{}
 
-	_, _, _, _, err := BlowNVMEM("test", f, "test", []byte{0x00})
+	_, _, _, _, _, err := BlowNVMEM("test", f, "test", []byte{0x00})
 
 	if err == nil || err.Error() != "fusemap has not been validated yet" {
 		t.Error("fusemap that has not been validated should raise an error")
@@ -54,6 +69,8 @@ func TestInvalidFuseMap(t *testing.T) {
 }
 
 func TestBlowErrors(t *testing.T) {
+	tempLockDir(t)
+
 	testYAML := `
 ---
 reference: test
@@ -74,19 +91,19 @@ registers:
 		t.Fatal(err)
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "OTP1", []byte{})
+	_, _, _, _, _, err = BlowNVMEM("", f, "OTP1", []byte{})
 
 	if err == nil || err.Error() != "null value" {
 		t.Error("tripping a fuse with null length should raise an error")
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "OTP2", []byte{0xff})
+	_, _, _, _, _, err = BlowNVMEM("", f, "OTP2", []byte{0xff})
 
 	if err == nil || err.Error() != "could not find any register/fuse named OTP2" {
 		t.Error("tripping an invalid fuse should raise an error")
 	}
 
-	_, _, _, _, err = BlowNVMEM("invalid_file", f, "OTP1", []byte{0x00})
+	_, _, _, _, _, err = BlowNVMEM("invalid_file", f, "OTP1", []byte{0x00})
 
 	if err == nil || err.Error() != "open invalid_file: no such file or directory" {
 		t.Error("tripping a fuse with an invalid device should raise an error")
@@ -94,6 +111,8 @@ registers:
 }
 
 func TestOverBlow(t *testing.T) {
+	tempLockDir(t)
+
 	testYAML := `
 ---
 reference: test
@@ -114,25 +133,25 @@ registers:
 		t.Fatal(err)
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "OTP1", []byte{0xff})
+	_, _, _, _, _, err = BlowNVMEM("", f, "OTP1", []byte{0xff})
 
 	if err == nil || err.Error() != "value bit length 8 exceeds 4" {
 		t.Error("tripping a fuse with a value exceeding its size should raise an error")
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "OTP1", []byte{0x02})
+	_, _, _, _, _, err = BlowNVMEM("", f, "OTP1", []byte{0x02})
 
 	if err != nil {
 		t.Errorf("tripping a fuse with a value not exceeding its size should not raise an error (%v)", err)
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "REG1", []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee})
+	_, _, _, _, _, err = BlowNVMEM("", f, "REG1", []byte{0xaa, 0xbb, 0xcc, 0xdd, 0xee})
 
 	if err == nil || err.Error() != "value bit length 40 exceeds 32" {
 		t.Error("tripping a register with a value exceeding its size should raise an error")
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "REG1", []byte{0xaa, 0xbb, 0xcc, 0xdd})
+	_, _, _, _, _, err = BlowNVMEM("", f, "REG1", []byte{0xaa, 0xbb, 0xcc, 0xdd})
 
 	if err != nil {
 		t.Errorf("tripping a register with a value not exceeding its size should not raise an error (%v)", err)
@@ -140,6 +159,8 @@ registers:
 }
 
 func TestBlow(t *testing.T) {
+	tempLockDir(t)
+
 	y := `
 ---
 reference: test
@@ -209,6 +230,8 @@ registers:
 }
 
 func TestBlowIMX6UL(t *testing.T) {
+	tempLockDir(t)
+
 	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
 
 	if err != nil {
@@ -227,6 +250,8 @@ func TestBlowIMX6UL(t *testing.T) {
 }
 
 func TestBlowAndRead(t *testing.T) {
+	tempLockDir(t)
+
 	y := `
 ---
 reference: test
@@ -295,13 +320,15 @@ registers:
 }
 
 func TestBlowIMX53(t *testing.T) {
+	tempLockDir(t)
+
 	f, err := fusemap.Find(fusemaps, "IMX53", "2.1")
 
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	_, _, _, _, err = BlowNVMEM("", f, "SRK_LOCK", []byte{0xff})
+	_, _, _, _, _, err = BlowNVMEM("", f, "SRK_LOCK", []byte{0xff})
 
 	if err == nil || err.Error() != "driver does not support blow operation" {
 		t.Errorf("tripping a fuse on a read/only driver should raise an error")
@@ -325,6 +352,8 @@ func readTest(t *testing.T, devicePath string, f *fusemap.FuseMap, name string,
 }
 
 func TestReadErrors(t *testing.T) {
+	tempLockDir(t)
+
 	f, err := fusemap.Find(fusemaps, "IMX53", "2.1")
 
 	if err != nil {
@@ -339,6 +368,8 @@ func TestReadErrors(t *testing.T) {
 }
 
 func TestReadIMX53(t *testing.T) {
+	tempLockDir(t)
+
 	f, err := fusemap.Find(fusemaps, "IMX53", "2.1")
 
 	if err != nil {
@@ -369,6 +400,8 @@ func TestReadIMX53(t *testing.T) {
 }
 
 func TestReadIMX6UL(t *testing.T) {
+	tempLockDir(t)
+
 	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
 
 	if err != nil {
@@ -421,6 +454,8 @@ func TestReadIMX6UL(t *testing.T) {
 }
 
 func TestReadBitMap8(t *testing.T) {
+	tempLockDir(t)
+
 	exp := ` 07 06 05 04 03 02 01 00  BANK0_WORD0
 ┏━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┓ Bank:0 Word:0
 ┃0 ┃0 ┃0 ┃1 ┃0 ┃0 ┃0 ┃0 ┃ R: 0x00000000
@@ -458,6 +493,8 @@ func TestReadBitMap8(t *testing.T) {
 }
 
 func TestReadBitMap32(t *testing.T) {
+	tempLockDir(t)
+
 	exp := ` 31 30 29 28 27 26 25 24 23 22 21 20 19 18 17 16 15 14 13 12 11 10 09 08 07 06 05 04 03 02 01 00  OCOTP_CFG1
 ┏━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┳━━┓ Bank:0 Word:2
 ┃0  0  1  0  0  1  1  1 ┃0  0  0  1  0  0  0  0 ┃0  1  0  0  0 ┃0  0  1  1  1  0  1  0  1  0  0 ┃ R: 0x00000008
@@ -491,3 +528,500 @@ func TestReadBitMap32(t *testing.T) {
 		t.Errorf("unexpected map\n%s\n  !=\n%s", m, exp)
 	}
 }
+
+func TestSnapshotIMX6UL(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := "../test/nvmem.IMX6UL"
+
+	s, err := SnapshotNVMEM(devicePath, f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.Processor != "IMX6UL" || s.Reference != "1" || s.Device != devicePath {
+		t.Errorf("snapshot with unexpected identity, %s %s %s", s.Processor, s.Reference, s.Device)
+	}
+
+	uid, _, _, _, err := ReadNVMEM(devicePath, f, "UNIQUE_ID")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if s.UniqueID != fmt.Sprintf("%#x", uid) {
+		t.Errorf("snapshot with unexpected unique identifier, %s != %#x", s.UniqueID, uid)
+	}
+
+	for _, name := range []string{"OCOTP_CFG1", "SRK_HASH", "MAC1_ADDR", "GP3"} {
+		exp, _, _, _, err := ReadNVMEM(devicePath, f, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		res, _, _, _, err := s.Read(f, name)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(res, exp) {
+			t.Errorf("snapshot register %s with unexpected value, %x != %x", name, res, exp)
+		}
+	}
+}
+
+func TestBlowWriteError(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = os.Stat("/dev/full"); err != nil {
+		t.Skip("/dev/full not available")
+	}
+
+	_, _, _, _, _, err = BlowNVMEM("/dev/full", f, "MAC1_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3})
+
+	var werr *WriteError
+
+	if !errors.As(err, &werr) {
+		t.Fatalf("failed multi-word write should raise a WriteError (%v)", err)
+	}
+
+	if len(werr.Words) != 2 || werr.Written() != 0 {
+		t.Fatalf("unexpected write outcome (%d/%d words written)", werr.Written(), len(werr.Words))
+	}
+
+	if w := werr.Failed(); w == nil || w.Address != 0x88 || !bytes.Equal(w.Value, []byte{0xe3, 0x07, 0x10, 0x7b}) {
+		t.Error("unexpected failed word")
+	}
+
+	if werr.Words[1].Written || werr.Words[1].Err != nil {
+		t.Error("words following a failed one should not be attempted")
+	}
+}
+
+func TestContextCancel(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tempDir := t.TempDir()
+	devicePath := filepath.Join(tempDir, "nvmem")
+
+	if err = os.WriteFile(devicePath, make([]byte, 512), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	var rerr *ReadError
+	var werr *WriteError
+
+	_, _, _, _, err = ReadNVMEMContext(ctx, devicePath, f, "SRK_HASH")
+
+	if !errors.As(err, &rerr) || !errors.Is(err, context.Canceled) || rerr.Read != 0 || rerr.Words != 8 {
+		t.Errorf("cancelled read should raise a ReadError (%v)", err)
+	}
+
+	j, err := OpenJournal(filepath.Join(tempDir, "journal"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = j.Close() }()
+
+	_, _, _, _, _, err = j.BlowNVMEMContext(ctx, devicePath, f, "MAC1_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3})
+
+	if !errors.As(err, &werr) || !errors.Is(err, context.Canceled) || werr.Written() != 0 {
+		t.Errorf("cancelled blow should raise a WriteError (%v)", err)
+	}
+
+	records, err := ReadJournal(j.Path())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending, _ := Pending(records); len(pending) != 1 {
+		t.Error("cancelled blow should remain pending in the journal")
+	}
+
+	op, written, err := j.ResumeNVMEM(devicePath, f)
+
+	if err != nil || op == nil || len(written) != 2 {
+		t.Errorf("cancelled blow should be resumed (%v)", err)
+	}
+}
+
+func TestBlowECC(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX8MP", "0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+
+	if err = os.WriteFile(devicePath, make([]byte, 1024), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "MAC_0_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}); err != nil {
+		t.Fatal(err)
+	}
+
+	var eccErr *ECCError
+
+	// MAC_1_ADDR shares an ECC protected word with MAC_0_ADDR
+	_, _, _, _, _, err = BlowNVMEM(devicePath, f, "MAC_1_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe4})
+
+	if !errors.As(err, &eccErr) {
+		t.Fatalf("partial write on fused ECC word should raise an ECCError (%v)", err)
+	}
+
+	if eccErr.Register != "OCOTP_MAC_ADDR1" || eccErr.Address != 0x94 {
+		t.Errorf("unexpected ECC error, %v", eccErr)
+	}
+
+	res, _, _, _, err := ReadNVMEM(devicePath, f, "OCOTP_MAC_ADDR2")
+
+	if err != nil || !bytes.Equal(res, []byte{0x00, 0x00, 0x00, 0x00}) {
+		t.Errorf("refused ECC write should not alter the device (%x, %v)", res, err)
+	}
+
+	// words without ECC protection are unaffected
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "CST_SRK_REVOKE[3:0]", []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "CST_SRK_REVOKE[3:0]", []byte{0x02}); err != nil {
+		t.Error(err)
+	}
+}
+
+// scuModel simulates an nvmem-imx-scu-ocotp NVMEM device, which takes byte
+// offsets converted to OTP word indices by the driver (index = offset >> 2),
+// only aligned accesses are allowed.
+type scuModel struct {
+	words [800]uint32
+}
+
+func (m *scuModel) ReadAt(p []byte, off int64) (n int, err error) {
+	if off%4 != 0 || len(p)%4 != 0 {
+		return 0, errors.New("unaligned read")
+	}
+
+	for i := 0; i < len(p); i += 4 {
+		binary.LittleEndian.PutUint32(p[i:], m.words[(off+int64(i))>>2])
+	}
+
+	return len(p), nil
+}
+
+func (m *scuModel) WriteAt(p []byte, off int64) (n int, err error) {
+	if off%4 != 0 || len(p) != 4 {
+		return 0, errors.New("invalid write size")
+	}
+
+	m.words[off>>2] |= binary.LittleEndian.Uint32(p)
+
+	return len(p), nil
+}
+
+func TestSCUAddressing(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX8QXP", "0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m := &scuModel{}
+
+	res, addr, _, _, _, err := BlowNVMEM("", f, "MAC0_ADDR", []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if addr != 708*4 {
+		t.Fatalf("unexpected NVMEM offset %#x", addr)
+	}
+
+	for i := 0; i < len(res); i += f.WordSize {
+		if err = writeWord(m, nil, addr+uint32(i), res[i:i+f.WordSize]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if m.words[708] != 0x7b1007e3 || m.words[709] != 0x1f {
+		t.Errorf("unexpected OTP words (%#x %#x)", m.words[708], m.words[709])
+	}
+
+	for i, w := range m.words {
+		if i != 708 && i != 709 && w != 0 {
+			t.Errorf("unexpected OTP word %d (%#x)", i, w)
+		}
+	}
+
+	addr, off, bitLen, err := readParams(f, "MAC0_ADDR")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	res, err = readNVMEM(context.Background(), m, f, addr, off, bitLen)
+
+	if err != nil || !bytes.Equal(res, []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}) {
+		t.Errorf("unexpected read value (%x, %v)", res, err)
+	}
+}
+
+func TestBlowIMX8QXP(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX8QXP", "0")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+
+	// simulated NVMEM device, addressed by byte offset
+	if err = os.WriteFile(devicePath, make([]byte, 800*4), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	blowTest(t, f, devicePath, "MAC0_ADDR[31:0]", []byte{0x10, 0x07, 0xe3}, []byte{0xe3, 0x07, 0x10, 0x00}, 708*4)
+
+	buf, err := os.ReadFile(devicePath)
+
+	if err != nil || !bytes.Equal(buf[708*4:709*4], []byte{0xe3, 0x07, 0x10, 0x00}) {
+		t.Fatalf("OTP word should be written at its byte offset (%v)", err)
+	}
+
+	if !bytes.Equal(buf[708:712], make([]byte, 4)) {
+		t.Fatal("OTP word should not be written at its index")
+	}
+
+	res, _, _, _, err := ReadNVMEM(devicePath, f, "MAC0_ADDR[31:0]")
+
+	if err != nil || !bytes.Equal(res, []byte{0x00, 0x10, 0x07, 0xe3}) {
+		t.Errorf("unexpected read value (%x, %v)", res, err)
+	}
+
+	var eccErr *ECCError
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "MAC0_ADDR", []byte{0x01}); !errors.As(err, &eccErr) || eccErr.Address != 708*4 {
+		t.Errorf("write on fused ECC word should raise an ECCError (%v)", err)
+	}
+
+	s, err := SnapshotNVMEM(devicePath, f)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(s.Words) != 800*4 || !bytes.Equal(s.Words[708*4:709*4], []byte{0xe3, 0x07, 0x10, 0x00}) {
+		t.Errorf("snapshot should be in word order (%x)", s.Words[708*4:709*4])
+	}
+}
+
+func TestBlowReadOnly(t *testing.T) {
+	tempLockDir(t)
+
+	testYAML := `
+---
+reference: test
+driver: nvmem-imx-scu-ocotp
+bank_size: 800
+registers:
+  REG1:
+    bank: 0
+    word: 1
+  REG2:
+    bank: 0
+    word: 2
+    read_only: true
+...
+`
+
+	f, err := fusemap.Parse([]byte(testYAML))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+
+	if err = os.WriteFile(devicePath, make([]byte, 16), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, _, _, _, err = BlowNVMEM(devicePath, f, "REG2", []byte{0x01})
+
+	if err == nil || err.Error() != "REG2 is read-only" {
+		t.Errorf("write on read-only register should raise an error (%v)", err)
+	}
+
+	// REG1 is written at its byte offset
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "REG1", []byte{0x01}); err != nil {
+		t.Fatal(err)
+	}
+
+	if buf, _ := os.ReadFile(devicePath); !bytes.Equal(buf, []byte{0, 0, 0, 0, 0x01, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}) {
+		t.Errorf("unexpected device content (%x)", buf)
+	}
+}
+
+func TestBlowIMX93(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "IMX93", "4")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+
+	if err = os.WriteFile(devicePath, make([]byte, 2048), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	mac := []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}
+
+	// MAC2_ADDR starts halfway through its first word
+	blowTest(t, f, devicePath, "MAC2_ADDR", mac, []byte{0x00, 0x00, 0xe3, 0x07, 0x10, 0x7b, 0x1f, 0x00}, 0x4f0)
+
+	res, _, _, _, err := ReadNVMEM(devicePath, f, "MAC2_ADDR")
+
+	if err != nil || !bytes.Equal(res, mac) {
+		t.Errorf("unexpected read value (%x, %v)", res, err)
+	}
+
+	words, addr, err := ReadWordsNVMEM(devicePath, f, "MAC2_ADDR")
+
+	if err != nil || addr != 0x4f0 || !bytes.Equal(words, []byte{0x00, 0x00, 0xe3, 0x07, 0x10, 0x7b, 0x1f, 0x00}) {
+		t.Errorf("unexpected raw words (%#x %x, %v)", addr, words, err)
+	}
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "SRK_HASH", bytes.Repeat([]byte{0xaa}, 32)); err != nil {
+		t.Fatal(err)
+	}
+
+	var eccErr *ECCError
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "OTP_SRK_HASH7", []byte{0x01}); !errors.As(err, &eccErr) || eccErr.Address != 0x21c {
+		t.Errorf("write on fused ECC word should raise an ECCError (%v)", err)
+	}
+
+	// words outside ELE fuse write requests (e.g. lifecycle)
+	lifecycle := uint32(0x0c)
+	reg := &fusemap.Register{Name: "OTP_LIFECYCLE", Address: &lifecycle, Length: 32}
+
+	if err = f.SetAddress(reg); err != nil {
+		t.Fatal(err)
+	}
+
+	f.Registers[reg.Name] = reg
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "OTP_LIFECYCLE", []byte{0x01}); err == nil {
+		t.Error("write on word not writable through ELE should raise an error")
+	}
+
+	if buf, _ := os.ReadFile(devicePath); buf[lifecycle] != 0x00 {
+		t.Errorf("refused write should not alter device content (%x)", buf[lifecycle])
+	}
+}
+
+func TestBlowSTM32MP15(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "STM32MP15", "6")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+
+	if err = os.WriteFile(devicePath, make([]byte, 96*4), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	// lower words are bitwise programmable
+	blowTest(t, f, devicePath, "OTP_PKH0", []byte{0x01}, []byte{0x01, 0x00, 0x00, 0x00}, 24*4)
+	blowTest(t, f, devicePath, "OTP_PKH0", []byte{0x02}, []byte{0x02, 0x00, 0x00, 0x00}, 24*4)
+
+	// upper words are word programmable
+	blowTest(t, f, devicePath, "MAC_ADDR", []byte{0x00, 0x80, 0xe1, 0x10, 0x07, 0xe3}, []byte{0xe3, 0x07, 0x10, 0xe1, 0x80, 0x00, 0x00, 0x00}, 57*4)
+
+	var lockErr *LockError
+
+	if _, _, _, _, _, err = BlowNVMEM(devicePath, f, "MAC_ADDR[31:0]", []byte{0x01}); !errors.As(err, &lockErr) || lockErr.Register != "OTP_MAC0" {
+		t.Errorf("write on fused upper word should raise a LockError (%v)", err)
+	}
+
+	_, _, _, _, _, err = BlowNVMEM(devicePath, f, "UID", []byte{0x01})
+
+	if err == nil || err.Error() != "OTP_UID0 is read-only" {
+		t.Errorf("write on factory programmed word should raise an error (%v)", err)
+	}
+}
+
+func TestReadH3(t *testing.T) {
+	tempLockDir(t)
+
+	f, err := fusemap.Find(fusemaps, "H3", "1.2")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	devicePath := filepath.Join(t.TempDir(), "nvmem")
+	sid := make([]byte, 256)
+	copy(sid, []byte{0x02, 0xc0, 0x04, 0x82, 0x7c, 0x30, 0x51, 0x4c, 0x30, 0x33, 0x33, 0x30, 0x0c, 0x02, 0x10, 0x54})
+
+	if err = os.WriteFile(devicePath, sid, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	res, addr, _, _, err := ReadNVMEM(devicePath, f, "CHIPID")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []byte{0x54, 0x10, 0x02, 0x0c, 0x30, 0x33, 0x33, 0x30, 0x4c, 0x51, 0x30, 0x7c, 0x82, 0x04, 0xc0, 0x02}; addr != 0 || !bytes.Equal(res, exp) {
+		t.Errorf("unexpected read value, %x != %x", res, exp)
+	}
+
+	_, _, _, _, _, err = BlowNVMEM(devicePath, f, "THS_CALIBRATION", []byte{0x01})
+
+	if err == nil || err.Error() != "driver does not support blow operation" {
+		t.Errorf("blow on read-only driver should raise an error (%v)", err)
+	}
+}
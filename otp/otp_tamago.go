@@ -11,23 +11,44 @@
 package otp
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
 	"time"
 
+	"github.com/usbarmory/crucible/fusemap"
 	"github.com/usbarmory/crucible/util"
 	"github.com/usbarmory/tamago/soc/nxp/ocotp"
 )
 
 // Blow an OTP fuse using the NXP On-Chip OTP Controller.
 //
+// The outcome of each OTP word write is returned, multi-word write failures
+// are also reported with a *WriteError detailing which words have been
+// written.
+//
 // WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
 // fuses values on the device. This means that any errors in the process, or
 // lost fused data such as cryptographic key material, might result in a
 // **bricked** device.
 //
 // The use of this function is therefore **at your own risk**.
-func BlowOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int, val []byte) (err error) {
+func BlowOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int, val []byte) (words []Word, err error) {
+	return BlowOCOTPContext(context.Background(), otp, bank, word, off, bitLen, val)
+}
+
+// BlowOCOTPContext performs BlowOCOTP() checking the argument context for
+// cancellation before each OTP word write. An OTP word write, including its
+// completion delay, is never interrupted, a cancelled multi-word operation is
+// reported with a *WriteError detailing which words have been written.
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func BlowOCOTPContext(ctx context.Context, otp *ocotp.OCOTP, bank int, word int, off int, bitLen int, val []byte) (words []Word, err error) {
 	if len(val) == 0 {
 		return
 	}
@@ -41,17 +62,33 @@ func BlowOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int, val []
 	val = util.Pad4(val)
 
 	if otp == nil {
-		return errors.New("missing OCOTP instance")
+		return nil, errors.New("missing OCOTP instance")
 	}
 
-	// write one complete OTP word write at the time
+	words = make([]Word, 0, len(val)/ocotp.WordSize)
+
 	for i := 0; i < len(val); i += ocotp.WordSize {
-		w := word + (i / ocotp.WordSize)
-		v := binary.LittleEndian.Uint32(val[i : i+ocotp.WordSize])
+		words = append(words, Word{
+			Address: uint32(ocotp.BankSize*bank + word + i/ocotp.WordSize),
+			Value:   val[i : i+ocotp.WordSize],
+		})
+	}
+
+	// write one complete OTP word write at the time
+	for i, w := range words {
+		if werr := ctx.Err(); werr != nil {
+			words[i].Err = werr
+			return words, &WriteError{Words: words}
+		}
+
+		v := binary.LittleEndian.Uint32(w.Value)
 
-		if err = otp.Blow(bank, w, v); err != nil {
-			return
+		if werr := otp.Blow(bank, word+i, v); werr != nil {
+			words[i].Err = werr
+			return words, &WriteError{Words: words}
 		}
+
+		words[i].Written = true
 		time.Sleep(10 * time.Millisecond)
 	}
 
@@ -60,6 +97,13 @@ func BlowOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int, val []
 
 // Read an OTP fuse using the NXP On-Chip OTP Controller.
 func ReadOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int) (res []byte, err error) {
+	return ReadOCOTPContext(context.Background(), otp, bank, word, off, bitLen)
+}
+
+// ReadOCOTPContext performs ReadOCOTP() checking the argument context for
+// cancellation before each OTP word read. A cancelled multi-word operation is
+// reported with a *ReadError detailing how many words have been read.
+func ReadOCOTPContext(ctx context.Context, otp *ocotp.OCOTP, bank int, word int, off int, bitLen int) (res []byte, err error) {
 	regSize := ocotp.WordSize * 8
 	numRegisters := 1 + (off+bitLen)/regSize
 
@@ -78,6 +122,15 @@ func ReadOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int) (res [
 	for i := 0; i < len(res); i += ocotp.WordSize {
 		w := word + (i / ocotp.WordSize)
 
+		if err = ctx.Err(); err != nil {
+			return nil, &ReadError{
+				Address: uint32(ocotp.BankSize*bank + w),
+				Read:    i / ocotp.WordSize,
+				Words:   len(res) / ocotp.WordSize,
+				Err:     err,
+			}
+		}
+
 		val, err := otp.Read(bank, w)
 
 		if err != nil {
@@ -93,3 +146,131 @@ func ReadOCOTP(otp *ocotp.OCOTP, bank int, word int, off int, bitLen int) (res [
 
 	return
 }
+
+// ocotpParams returns the bank, word, offset and bit length of a register or
+// fuse for use with the NXP On-Chip OTP Controller.
+func ocotpParams(f *fusemap.FuseMap, name string) (bank int, word int, off int, bitLen int, err error) {
+	if !f.Valid() {
+		err = errors.New("fusemap has not been validated yet")
+		return
+	}
+
+	if f.Driver != "nvmem-imx-ocotp" || f.BankSize != ocotp.BankSize || f.WordSize != ocotp.WordSize {
+		err = errors.New("fusemap not supported by OCOTP driver")
+		return
+	}
+
+	mapping, err := f.Find(name)
+
+	if err != nil {
+		return
+	}
+
+	var reg *fusemap.Register
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		reg = m
+		off = 0
+		bitLen = reg.Length
+	case *fusemap.Fuse:
+		reg = m.Register
+		off = m.Offset
+		bitLen = m.Length
+	}
+
+	index := f.Index(reg)
+	bank = index / ocotp.BankSize
+	word = index % ocotp.BankSize
+
+	return
+}
+
+// Blow an OTP fuse, by name, using the NXP On-Chip OTP Controller. The name
+// argument could be a register or an individual OTP fuse defined in the
+// argument fusemap (see package fusemaps for bundled ones).
+//
+// Writes to ECC protected words which already hold data are refused with an
+// *ECCError, writes to read-only registers are always refused.
+//
+// The value parameter is interpreted as a big-endian value, with the same
+// semantics of BlowNVMEM().
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func Blow(otp *ocotp.OCOTP, f *fusemap.FuseMap, name string, val []byte) (words []Word, err error) {
+	return BlowContext(context.Background(), otp, f, name, val)
+}
+
+// BlowContext performs Blow() checking the argument context for cancellation
+// before each OTP word write, see BlowOCOTPContext().
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this function is therefore **at your own risk**.
+func BlowContext(ctx context.Context, otp *ocotp.OCOTP, f *fusemap.FuseMap, name string, val []byte) (words []Word, err error) {
+	if len(val) == 0 {
+		return nil, errors.New("null value")
+	}
+
+	bank, word, off, bitLen, err := ocotpParams(f, name)
+
+	if err != nil {
+		return
+	}
+
+	if otp == nil {
+		return nil, errors.New("missing OCOTP instance")
+	}
+
+	res, err := util.ConvertWriteValue(off, bitLen, val)
+
+	if err != nil {
+		return
+	}
+
+	index := bank*ocotp.BankSize + word
+	n := len(util.Pad4(res)) / ocotp.WordSize
+
+	err = checkWrite(f, index, n, func(i int) (addr uint32, cur []byte, err error) {
+		addr = uint32(index + i)
+		cur = make([]byte, ocotp.WordSize)
+
+		v, err := otp.Read((index+i)/ocotp.BankSize, (index+i)%ocotp.BankSize)
+		binary.LittleEndian.PutUint32(cur, v)
+
+		return
+	})
+
+	if err != nil {
+		return
+	}
+
+	return BlowOCOTPContext(ctx, otp, bank, word, off, bitLen, val)
+}
+
+// Read an OTP fuse, by name, using the NXP On-Chip OTP Controller. The name
+// argument could be a register or an individual OTP fuse defined in the
+// argument fusemap (see package fusemaps for bundled ones).
+func Read(otp *ocotp.OCOTP, f *fusemap.FuseMap, name string) (res []byte, err error) {
+	return ReadContext(context.Background(), otp, f, name)
+}
+
+// ReadContext performs Read() checking the argument context for cancellation
+// before each OTP word read, see ReadOCOTPContext().
+func ReadContext(ctx context.Context, otp *ocotp.OCOTP, f *fusemap.FuseMap, name string) (res []byte, err error) {
+	bank, word, off, bitLen, err := ocotpParams(f, name)
+
+	if err != nil {
+		return
+	}
+
+	return ReadOCOTPContext(ctx, otp, bank, word, off, bitLen)
+}
@@ -0,0 +1,81 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Allwinner Security ID registers
+const (
+	sidPrctl = 0x0040
+	sidRdkey = 0x0060
+
+	prctlOffsetShift = 16
+	prctlOffsetMask  = 0x1ff
+	prctlOpLock      = 0xac << 8
+	prctlRead        = 1 << 1
+
+	sidWordCount = 64
+
+	sidSize = 0x400
+)
+
+// SIDController represents an Allwinner Security ID (SID) eFuse controller,
+// as found on H3 and A64 series processors, operated through direct register
+// access.
+//
+// OTP words are read through explicit register based read operations, rather
+// than the memory mapped eFuse window which might report stale values on some
+// processors (e.g. H3) until such an operation takes place.
+//
+// Programming is not supported.
+type SIDController struct {
+	// MMIO is the controller register file
+	MMIO MMIO
+	// Timeout is the operation timeout, DefaultTimeout is used when zero.
+	Timeout time.Duration
+}
+
+// WordSize returns the number of bytes per OTP word.
+func (hw *SIDController) WordSize() int {
+	return 4
+}
+
+func (hw *SIDController) checkIndex(index int) error {
+	if index < 0 || index >= sidWordCount {
+		return fmt.Errorf("invalid OTP word index %d", index)
+	}
+
+	return nil
+}
+
+// ReadWord reads an OTP word through a register based read operation.
+func (hw *SIDController) ReadWord(index int) (val uint32, err error) {
+	if err = hw.checkIndex(index); err != nil {
+		return
+	}
+
+	ctrl := (uint32(index*4) & prctlOffsetMask) << prctlOffsetShift
+	hw.MMIO.Write(sidPrctl, ctrl|prctlOpLock|prctlRead)
+	defer hw.MMIO.Write(sidPrctl, 0)
+
+	if !wait(hw.MMIO, sidPrctl, prctlRead, 0, hw.Timeout) {
+		return 0, errors.New("SID read timeout")
+	}
+
+	return hw.MMIO.Read(sidRdkey), nil
+}
+
+// BlowWord is not supported.
+func (hw *SIDController) BlowWord(index int, val uint32) (err error) {
+	return errors.New("SID programming is not supported")
+}
@@ -0,0 +1,168 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"bytes"
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// Snapshot formats
+const (
+	JSON = "json"
+	YAML = "yaml"
+	Raw  = "raw"
+)
+
+// Words represents a raw NVMEM image, encoded as an hexadecimal string in
+// JSON and YAML snapshots.
+type Words []byte
+
+// MarshalText implements the encoding.TextMarshaler interface.
+func (w Words) MarshalText() ([]byte, error) {
+	return []byte(hex.EncodeToString(w)), nil
+}
+
+// UnmarshalText implements the encoding.TextUnmarshaler interface.
+func (w *Words) UnmarshalText(text []byte) (err error) {
+	*w, err = hex.DecodeString(string(text))
+	return
+}
+
+// Snapshot represents a copy of the OTP fuses state of a device, suitable for
+// offline decoding of its registers and fuses.
+type Snapshot struct {
+	// Processor is the fusemap processor model
+	Processor string `json:"processor"`
+	// Reference is the fusemap reference manual revision
+	Reference string `json:"reference"`
+	// Device identifies the device the snapshot was taken from
+	Device string `json:"device"`
+	// UniqueID is the chip unique identifier, when defined by the fusemap
+	UniqueID string `json:"unique_id,omitempty"`
+	// Time is the snapshot timestamp
+	Time time.Time `json:"time"`
+	// Words holds the raw NVMEM image
+	Words Words `json:"words"`
+}
+
+// SnapshotFormat returns the snapshot format associated to a file path
+// extension, files without a JSON or YAML extension are treated as raw binary
+// images.
+func SnapshotFormat(path string) string {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		return JSON
+	case ".yaml", ".yml":
+		return YAML
+	default:
+		return Raw
+	}
+}
+
+// ParseSnapshot converts a JSON, YAML or raw binary payload to a Snapshot
+// structure. Raw binary payloads only populate snapshot words.
+func ParseSnapshot(buf []byte, format string) (s *Snapshot, err error) {
+	s = &Snapshot{}
+
+	switch format {
+	case JSON:
+		err = json.Unmarshal(buf, s)
+	case YAML:
+		err = yaml.Unmarshal(buf, s)
+	case Raw:
+		s.Words = buf
+	default:
+		err = fmt.Errorf("invalid snapshot format %s", format)
+	}
+
+	return
+}
+
+// OpenSnapshot parses a snapshot file, the format is selected according to
+// the file extension (see SnapshotFormat()).
+func OpenSnapshot(path string) (s *Snapshot, err error) {
+	buf, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	return ParseSnapshot(buf, SnapshotFormat(path))
+}
+
+// Marshal converts a snapshot to JSON, YAML or a raw binary image.
+func (s *Snapshot) Marshal(format string) (buf []byte, err error) {
+	switch format {
+	case JSON:
+		buf, err = json.MarshalIndent(s, "", "\t")
+	case YAML:
+		buf, err = yaml.Marshal(s)
+	case Raw:
+		buf = s.Words
+	default:
+		err = fmt.Errorf("invalid snapshot format %s", format)
+	}
+
+	return
+}
+
+// Save writes a snapshot file, the format is selected according to the file
+// extension (see SnapshotFormat()).
+func (s *Snapshot) Save(path string) (err error) {
+	buf, err := s.Marshal(SnapshotFormat(path))
+
+	if err != nil {
+		return
+	}
+
+	return os.WriteFile(path, buf, 0600)
+}
+
+// Read decodes a register or fuse from the snapshot, with the same semantics
+// of ReadNVMEM(). The name argument could be a register or an individual OTP
+// fuse.
+func (s *Snapshot) Read(f *fusemap.FuseMap, name string) (res []byte, addr uint32, off int, bitLen int, err error) {
+	if len(s.Words) == 0 {
+		err = errors.New("empty snapshot")
+		return
+	}
+
+	if s.Processor != "" && s.Processor != f.Processor {
+		err = fmt.Errorf("snapshot processor mismatch (%s != %s)", s.Processor, f.Processor)
+		return
+	}
+
+	if s.Reference != "" && s.Reference != f.Reference {
+		err = fmt.Errorf("snapshot reference mismatch (%s != %s)", s.Reference, f.Reference)
+		return
+	}
+
+	addr, off, bitLen, err = readParams(f, name)
+
+	if err != nil {
+		return
+	}
+
+	res, err = readNVMEM(context.Background(), bytes.NewReader(s.Words), f, addr, off, bitLen)
+
+	return
+}
@@ -0,0 +1,120 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package otp
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+func TestSnapshotFormat(t *testing.T) {
+	for path, exp := range map[string]string{
+		"dump.json": JSON,
+		"dump.YAML": YAML,
+		"dump.yml":  YAML,
+		"dump.bin":  Raw,
+		"nvmem":     Raw,
+	} {
+		if format := SnapshotFormat(path); format != exp {
+			t.Errorf("unexpected format for %s, %s != %s", path, format, exp)
+		}
+	}
+}
+
+func TestSnapshotErrors(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Snapshot{}
+
+	_, _, _, _, err = s.Read(f, "SRK_HASH")
+
+	if err == nil || err.Error() != "empty snapshot" {
+		t.Error("decoding an empty snapshot should raise an error")
+	}
+
+	s = &Snapshot{Processor: "IMX53", Words: []byte{0x00}}
+
+	_, _, _, _, err = s.Read(f, "SRK_HASH")
+
+	if err == nil || err.Error() != "snapshot processor mismatch (IMX53 != IMX6UL)" {
+		t.Error("decoding a snapshot against a different processor should raise an error")
+	}
+
+	_, err = ParseSnapshot(nil, "invalid")
+
+	if err == nil || err.Error() != "invalid snapshot format invalid" {
+		t.Error("parsing a snapshot with an invalid format should raise an error")
+	}
+}
+
+func TestSnapshotSave(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	words, err := os.ReadFile("../test/nvmem.IMX6UL")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := &Snapshot{
+		Processor: f.Processor,
+		Reference: f.Reference,
+		Device:    "imx-ocotp0",
+		UniqueID:  "0x271041d4e6b56512",
+		Time:      time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		Words:     words,
+	}
+
+	tempDir := t.TempDir()
+
+	for _, name := range []string{"dump.json", "dump.yaml", "dump.bin"} {
+		path := filepath.Join(tempDir, name)
+
+		if err = s.Save(path); err != nil {
+			t.Fatal(err)
+		}
+
+		l, err := OpenSnapshot(path)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !bytes.Equal(l.Words, s.Words) {
+			t.Errorf("loaded snapshot %s with unexpected words", name)
+		}
+
+		if SnapshotFormat(path) != Raw && (l.Device != s.Device || l.UniqueID != s.UniqueID || !l.Time.Equal(s.Time)) {
+			t.Errorf("loaded snapshot %s with unexpected identity", name)
+		}
+
+		res, _, _, _, err := l.Read(f, "MAC1_ADDR")
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if exp := []byte{0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3}; !bytes.Equal(res, exp) {
+			t.Errorf("decoded snapshot %s with unexpected value, %x != %x", name, res, exp)
+		}
+	}
+}
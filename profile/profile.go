@@ -0,0 +1,191 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package profile implements an expected-state format to describe
+// One-Time-Programmable (OTP) fuse values, dump them from a device and verify
+// a device against them (e.g. for end-of-line testing).
+package profile
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+
+	"github.com/ghodss/yaml"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/manifest"
+	"github.com/usbarmory/crucible/util"
+)
+
+// Profile represents the expected state of a collection of fuses on a given
+// processor.
+type Profile struct {
+	Processor string   `json:"processor"`
+	Reference string   `json:"reference"`
+	Fuses     []*Entry `json:"fuses"`
+}
+
+// Entry represents the expected state of a register or fuse, exactly one of
+// Value, Zero or Ignore must be set.
+type Entry struct {
+	Name string `json:"name"`
+	// Value is the expected value
+	Value manifest.Value `json:"value,omitempty"`
+	// Mask restricts comparison to its set bits (optional, with Value)
+	Mask       manifest.Value `json:"mask,omitempty"`
+	Base       int            `json:"base,omitempty"`
+	Endianness string         `json:"endianness,omitempty"`
+	// Zero requires all bits to be zero ("must be zero")
+	Zero bool `json:"zero,omitempty"`
+	// Ignore excludes the entry from verification ("don't care")
+	Ignore bool `json:"ignore,omitempty"`
+}
+
+// Expected returns the expected value and comparison mask of the entry, as
+// big-endian byte arrays of bitLen bits.
+func (e *Entry) Expected(bitLen int) (val []byte, mask []byte, err error) {
+	v := new(big.Int)
+	m := new(big.Int).Lsh(big.NewInt(1), uint(bitLen))
+	m.Sub(m, big.NewInt(1))
+
+	switch {
+	case e.Ignore:
+		m.SetInt64(0)
+	case e.Zero:
+	default:
+		buf, err := util.ParseValue(string(e.Value), e.Base, e.Endianness)
+
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", e.Name, err)
+		}
+
+		v.SetBytes(buf)
+
+		if e.Mask != "" {
+			if buf, err = util.ParseValue(string(e.Mask), e.Base, e.Endianness); err != nil {
+				return nil, nil, fmt.Errorf("%s: mask %v", e.Name, err)
+			}
+
+			m.SetBytes(buf)
+		}
+	}
+
+	if v.BitLen() > bitLen || m.BitLen() > bitLen {
+		return nil, nil, fmt.Errorf("%s: value bit length exceeds %d", e.Name, bitLen)
+	}
+
+	return util.PadBigInt(v, bitLen), util.PadBigInt(m, bitLen), nil
+}
+
+// Parse converts a profile YAML (or JSON) payload to a Profile structure.
+func Parse(y []byte) (p *Profile, err error) {
+	p = &Profile{}
+
+	if err = yaml.Unmarshal(y, p); err != nil {
+		return
+	}
+
+	err = p.Validate()
+
+	return
+}
+
+// Open parses a profile YAML (or JSON) file, validates it and converts it to a
+// Profile structure.
+func Open(path string) (p *Profile, err error) {
+	y, err := os.ReadFile(path)
+
+	if err != nil {
+		return
+	}
+
+	return Parse(y)
+}
+
+// YAML returns the profile in YAML format.
+func (p *Profile) YAML() ([]byte, error) {
+	return yaml.Marshal(p)
+}
+
+// JSON returns the profile in JSON format.
+func (p *Profile) JSON() ([]byte, error) {
+	return json.MarshalIndent(p, "", "  ")
+}
+
+// Validate performs basic sanity checks on the profile entries.
+func (p *Profile) Validate() (err error) {
+	names := make(map[string]bool)
+
+	if p.Processor == "" {
+		return errors.New("missing processor")
+	}
+
+	if p.Reference == "" {
+		return errors.New("missing reference")
+	}
+
+	if len(p.Fuses) == 0 {
+		return errors.New("missing fuses")
+	}
+
+	for _, e := range p.Fuses {
+		if e == nil || e.Name == "" {
+			return errors.New("missing fuse name")
+		}
+
+		if _, ok := names[e.Name]; ok {
+			return fmt.Errorf("fuse names must be unique, double entry for %s", e.Name)
+		}
+		names[e.Name] = true
+
+		n := 0
+
+		for _, set := range []bool{e.Value != "", e.Zero, e.Ignore} {
+			if set {
+				n += 1
+			}
+		}
+
+		if n != 1 {
+			return fmt.Errorf("%s: exactly one of value, zero or ignore must be specified", e.Name)
+		}
+
+		if e.Mask != "" && e.Value == "" {
+			return fmt.Errorf("%s: mask requires a value", e.Name)
+		}
+
+		if _, _, err = e.Expected(512); err != nil {
+			return
+		}
+	}
+
+	return
+}
+
+// Check verifies that all profile entries are compatible with the argument
+// fusemap.
+func (p *Profile) Check(f *fusemap.FuseMap) (err error) {
+	if p.Processor != f.Processor {
+		return errors.New("processor mismatch")
+	}
+
+	if p.Reference != f.Reference {
+		return errors.New("reference mismatch")
+	}
+
+	for _, e := range p.Fuses {
+		if _, err = f.Find(e.Name); err != nil {
+			return
+		}
+	}
+
+	return
+}
@@ -0,0 +1,178 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package profile
+
+import (
+	"os"
+	"testing"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+var fusemaps = os.DirFS("../fusemaps")
+
+func TestInvalidProfile(t *testing.T) {
+	for _, test := range []struct {
+		entry string
+		err   string
+	}{
+		{
+			"name: SRK_LOCK",
+			"SRK_LOCK: exactly one of value, zero or ignore must be specified",
+		},
+		{
+			"{name: SRK_LOCK, zero: true, ignore: true}",
+			"SRK_LOCK: exactly one of value, zero or ignore must be specified",
+		},
+		{
+			"{name: SRK_LOCK, zero: true, mask: \"1\", base: 2, endianness: big}",
+			"SRK_LOCK: mask requires a value",
+		},
+		{
+			"{name: SRK_LOCK, value: \"1\", base: 2}",
+			"SRK_LOCK: invalid endianness",
+		},
+		{
+			"{name: SRK_LOCK, value: 1, base: 2, endianness: big}",
+			"error unmarshaling JSON: value 1 must be a quoted string",
+		},
+	} {
+		y := "---\nprocessor: IMX6UL\nreference: 1\nfuses:\n  - " + test.entry + "\n"
+
+		if _, err := Parse([]byte(y)); err == nil || err.Error() != test.err {
+			t.Errorf("unexpected error for %q, %v", test.entry, err)
+		}
+	}
+}
+
+func TestVerify(t *testing.T) {
+	y := `
+---
+processor: IMX6UL
+reference: 1
+fuses:
+  - name: SRK_LOCK
+    value: "1"
+    base: 2
+    endianness: big
+  - name: MAC1_ADDR
+    value: "0x001f7b000000"
+    mask: "0xffffff000000"
+    base: 16
+    endianness: big
+  - name: OCOTP_GP1
+    zero: true
+  - name: SI_REV
+    ignore: true
+  - name: OCOTP_GP2
+    value: "0xff000000"
+    base: 16
+    endianness: little
+...
+`
+
+	p, err := Parse([]byte(y))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := map[string][]byte{
+		"SRK_LOCK":  {0x01},
+		"MAC1_ADDR": {0x00, 0x1f, 0x7b, 0x10, 0x07, 0xe3},
+		"OCOTP_GP1": {0x00, 0x00, 0x00, 0x01},
+		"OCOTP_GP2": {0xff},
+	}
+
+	results, err := Verify(f, p, func(name string) ([]byte, error) {
+		if name == "SI_REV" {
+			t.Error("ignored entries should not be read")
+		}
+
+		return current[name], nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(results) != len(p.Fuses) {
+		t.Fatalf("unexpected number of results, %d", len(results))
+	}
+
+	for _, r := range results {
+		match := r.Entry.Name != "OCOTP_GP1"
+
+		if r.Match() != match {
+			t.Errorf("unexpected result for %s (cur:%#x val:%#x mask:%#x)", r.Entry.Name, r.Current, r.Value, r.Mask)
+		}
+	}
+
+	p.Processor = "IMX6ULL"
+
+	if _, err = Verify(f, p, nil); err == nil || err.Error() != "processor mismatch" {
+		t.Error("profile with mismatching processor should raise an error")
+	}
+}
+
+func TestDump(t *testing.T) {
+	f, err := fusemap.Find(fusemaps, "IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := Dump(f, func(name string) ([]byte, error) {
+		return []byte{0x01}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(p.Fuses) != len(f.Registers) {
+		t.Fatalf("unexpected number of entries, %d", len(p.Fuses))
+	}
+
+	y, err := p.YAML()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d, err := Parse(y)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Fuses[0].Value != "0x00000001" {
+		t.Errorf("unexpected dump value, %s", d.Fuses[0].Value)
+	}
+
+	results, err := Verify(f, d, func(name string) ([]byte, error) {
+		return []byte{0x01}, nil
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range results {
+		if !r.Match() {
+			t.Errorf("dumped profile should match for %s", r.Entry.Name)
+		}
+	}
+}
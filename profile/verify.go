@@ -0,0 +1,134 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package profile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/manifest"
+	"github.com/usbarmory/crucible/util"
+)
+
+// Result represents the verification of a profile entry.
+type Result struct {
+	// Entry is the profile entry
+	Entry *Entry
+	// Current is the current register or fuse value (big-endian)
+	Current []byte
+	// Value is the expected value (big-endian)
+	Value []byte
+	// Mask is the comparison mask (big-endian)
+	Mask []byte
+}
+
+// Match returns whether the current value matches the expected one, within
+// the comparison mask.
+func (r *Result) Match() bool {
+	for i := range r.Mask {
+		if (r.Current[i]^r.Value[i])&r.Mask[i] != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+func bitLength(mapping any) int {
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		return m.Length
+	case *fusemap.Fuse:
+		return m.Length
+	}
+
+	return 0
+}
+
+// Verify compares all profile entries against the values read from a device,
+// the returned results are in profile order.
+func Verify(f *fusemap.FuseMap, p *Profile, read manifest.Reader) (results []*Result, err error) {
+	if err = p.Check(f); err != nil {
+		return
+	}
+
+	for _, e := range p.Fuses {
+		mapping, err := f.Find(e.Name)
+
+		if err != nil {
+			return nil, err
+		}
+
+		bitLen := bitLength(mapping)
+		val, mask, err := e.Expected(bitLen)
+
+		if err != nil {
+			return nil, err
+		}
+
+		r := &Result{
+			Entry: e,
+			Value: val,
+			Mask:  mask,
+		}
+
+		if e.Ignore {
+			r.Current = make([]byte, len(val))
+			results = append(results, r)
+			continue
+		}
+
+		cur, err := read(e.Name)
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", e.Name, err)
+		}
+
+		r.Current = util.PadBigInt(new(big.Int).SetBytes(cur), bitLen)
+		results = append(results, r)
+	}
+
+	return
+}
+
+// Dump returns a profile of all fusemap registers, in read address order, with
+// their current value read from a device.
+//
+// Registers beyond the device size are skipped, as drivers which do not handle
+// addressing gaps might not expose the entire fusemap (see fusemap.Gap).
+func Dump(f *fusemap.FuseMap, read manifest.Reader) (p *Profile, err error) {
+	p = &Profile{
+		Processor: f.Processor,
+		Reference: f.Reference,
+	}
+
+	for _, reg := range f.RegistersByReadAddress() {
+		cur, err := read(reg.Name)
+
+		if errors.Is(err, io.EOF) {
+			continue
+		}
+
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v", reg.Name, err)
+		}
+
+		p.Fuses = append(p.Fuses, &Entry{
+			Name:       reg.Name,
+			Value:      manifest.Value(fmt.Sprintf("%#x", util.PadBigInt(new(big.Int).SetBytes(cur), reg.Length))),
+			Base:       16,
+			Endianness: "big",
+		})
+	}
+
+	return
+}
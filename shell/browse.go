@@ -0,0 +1,564 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package shell
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/usbarmory/crucible/fusemap"
+)
+
+// VT100 control sequences
+const (
+	clearScreen = "\x1b[H\x1b[2J"
+	clearLine   = "\x1b[K"
+	hideCursor  = "\x1b[?25l"
+	showCursor  = "\x1b[?25h"
+	reverse     = "\x1b[7m"
+	normal      = "\x1b[0m"
+)
+
+const browseHelp = "j/k:register h/l:fuse /:search n:next v:names r:read <>:scroll b:blow q:quit"
+
+// escape sequences for cursor and editing keys
+var keys = map[string]string{
+	"A":  "up",
+	"B":  "down",
+	"C":  "right",
+	"D":  "left",
+	"H":  "home",
+	"F":  "end",
+	"1~": "home",
+	"4~": "end",
+	"5~": "pgup",
+	"6~": "pgdn",
+}
+
+var errCancel = errors.New("cancelled")
+
+type browser struct {
+	*Shell
+
+	r *reader
+	w io.Writer
+
+	regs []*fusemap.Register
+
+	// selected register and fuse (-1 for the whole register)
+	reg  int
+	fuse int
+
+	// first register shown in the list
+	top int
+	// bit map horizontal scroll
+	shift int
+	// show fuse names, rather than values, in the bit map
+	names bool
+
+	values map[string][]byte
+	errs   map[string]error
+
+	matches []*fusemap.Match
+	match   int
+
+	status string
+}
+
+// Browse runs a full-screen fusemap browser on the argument terminal, listing
+// registers along with their bit map, current values and fuse details, until
+// it is quit or the terminal is closed.
+//
+// The terminal is driven with VT100 control sequences and must deliver input
+// without line buffering or echo (i.e. raw mode), making it suitable for
+// serial consoles. Blow operations require the same confirmation as the blow
+// command.
+func (s *Shell) Browse(term io.ReadWriter) error {
+	return s.browse(newReader(term), term)
+}
+
+func (s *Shell) browse(r *reader, w io.Writer) (err error) {
+	if s.FuseMap == nil {
+		return errors.New("missing fusemap")
+	}
+
+	b := &browser{
+		Shell:  s,
+		r:      r,
+		w:      w,
+		regs:   s.FuseMap.RegistersByWriteAddress(),
+		fuse:   -1,
+		values: make(map[string][]byte),
+		errs:   make(map[string]error),
+	}
+
+	if len(b.regs) == 0 {
+		return errors.New("empty fusemap")
+	}
+
+	_, _ = fmt.Fprint(w, hideCursor)
+	defer func() { _, _ = fmt.Fprint(w, normal+clearScreen+showCursor) }()
+
+	for {
+		b.draw()
+
+		k, err := b.key()
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if b.handle(k) {
+			return nil
+		}
+	}
+}
+
+// handle processes a key, returning whether the browser should be quit.
+func (b *browser) handle(k string) (quit bool) {
+	b.status = ""
+
+	switch k {
+	case "q", "\x03", "\x04":
+		return true
+	case "up", "k":
+		b.selectRegister(b.reg - 1)
+	case "down", "j":
+		b.selectRegister(b.reg + 1)
+	case "pgup":
+		b.selectRegister(b.reg - b.rows())
+	case "pgdn":
+		b.selectRegister(b.reg + b.rows())
+	case "home", "g":
+		b.selectRegister(0)
+	case "end", "G":
+		b.selectRegister(len(b.regs) - 1)
+	case "left", "h":
+		b.selectFuse(b.fuse - 1)
+	case "right", "l":
+		b.selectFuse(b.fuse + 1)
+	case "<":
+		b.shift = max(b.shift-8, 0)
+	case ">":
+		b.shift += 8
+	case "v":
+		b.names = !b.names
+	case "r":
+		b.values = make(map[string][]byte)
+		b.errs = make(map[string]error)
+		b.status = "values reloaded"
+	case "/":
+		b.search()
+	case "n":
+		b.next(1)
+	case "N":
+		b.next(-1)
+	case "b":
+		b.blow()
+	}
+
+	return
+}
+
+// key reads a key, translating escape sequences for cursor and editing keys.
+func (b *browser) key() (k string, err error) {
+	c, err := b.r.ReadByte()
+
+	if err != nil || c != 0x1b {
+		return string(c), err
+	}
+
+	if c, err = b.r.ReadByte(); err != nil || (c != '[' && c != 'O') {
+		return string(c), err
+	}
+
+	var seq []byte
+
+	for {
+		if c, err = b.r.ReadByte(); err != nil {
+			return
+		}
+
+		seq = append(seq, c)
+
+		if c >= 0x40 && c <= 0x7e {
+			break
+		}
+	}
+
+	return keys[string(seq)], nil
+}
+
+// input reads a line, echoing it, from the terminal.
+func (b *browser) input() (string, error) {
+	var buf []byte
+
+	for {
+		c, err := b.r.ReadByte()
+
+		if err != nil {
+			return "", err
+		}
+
+		switch {
+		case c == '\r' || c == '\n':
+			_, _ = fmt.Fprint(b.w, "\r\n")
+
+			return strings.TrimSpace(string(buf)), nil
+		case c == 0x03 || c == 0x1b:
+			return "", errCancel
+		case c == 0x7f || c == 0x08:
+			if len(buf) > 0 {
+				buf = buf[:len(buf)-1]
+				_, _ = fmt.Fprint(b.w, "\b \b")
+			}
+		case c >= 0x20 && c < 0x7f:
+			buf = append(buf, c)
+			_, _ = b.w.Write([]byte{c})
+		}
+	}
+}
+
+// prompt reads a line from the status line.
+func (b *browser) prompt(text string) (string, error) {
+	_, lines := b.size()
+
+	_, _ = fmt.Fprintf(b.w, "\x1b[%d;1H%s%s%s", lines-1, clearLine, text, showCursor)
+	defer func() { _, _ = fmt.Fprint(b.w, hideCursor) }()
+
+	return b.input()
+}
+
+func (b *browser) size() (columns int, lines int) {
+	columns = max(b.Columns, 40)
+	lines = max(b.Lines, 8)
+
+	if b.Columns == 0 {
+		columns = 80
+	}
+
+	if b.Lines == 0 {
+		lines = 24
+	}
+
+	return
+}
+
+// rows returns the number of registers shown in the list.
+func (b *browser) rows() int {
+	_, lines := b.size()
+	return lines - 3
+}
+
+func (b *browser) selectRegister(i int) {
+	i = min(max(i, 0), len(b.regs)-1)
+
+	if i != b.reg {
+		b.reg = i
+		b.fuse = -1
+	}
+}
+
+func (b *browser) selectFuse(i int) {
+	b.fuse = min(max(i, -1), len(b.regs[b.reg].Fuses)-1)
+}
+
+// selected returns the selected register or fuse parameters.
+func (b *browser) selected() (reg *fusemap.Register, name string, off int, bitLen int, desc string) {
+	reg = b.regs[b.reg]
+
+	if b.fuse < 0 {
+		return reg, reg.Name, 0, reg.Length, reg.Description
+	}
+
+	fuse := reg.FusesByOffset()[b.fuse]
+
+	return reg, fuse.Name, fuse.Offset, fuse.Length, fuse.Description
+}
+
+// read returns a register or fuse value, values are cached until reloaded.
+func (b *browser) read(name string) ([]byte, error) {
+	if b.Read == nil {
+		return nil, errors.New("read operation not supported")
+	}
+
+	if res, ok := b.values[name]; ok {
+		return res, b.errs[name]
+	}
+
+	res, err := b.Read(name)
+
+	b.values[name] = res
+	b.errs[name] = err
+
+	return res, err
+}
+
+// pad truncates or pads a string to the argument width.
+func pad(s string, width int) string {
+	r := []rune(s)
+
+	if len(r) > width {
+		return string(r[:width])
+	}
+
+	return s + strings.Repeat(" ", width-len(r))
+}
+
+// clip returns the argument width of a string, starting at the argument
+// offset.
+func clip(s string, off int, width int) string {
+	r := []rune(s)
+
+	if off >= len(r) {
+		return ""
+	}
+
+	r = r[off:]
+
+	if len(r) > width {
+		r = r[:width]
+	}
+
+	return string(r)
+}
+
+// details returns the selected register bit map and fuse details.
+func (b *browser) details(width int) (lines []string) {
+	var res []byte
+
+	reg, name, off, bitLen, desc := b.selected()
+	value := ""
+
+	if val, err := b.read(name); err != nil {
+		value = "error: " + err.Error()
+	} else if prefix, v, err := b.format(val, bitLen); err != nil {
+		value = "error: " + err.Error()
+	} else {
+		value = prefix + v
+	}
+
+	for _, line := range []string{
+		fmt.Sprintf("Name:     %s", name),
+		fmt.Sprintf("Register: %s bank:%d word:%d R:%#x W:%#x", reg.Name, reg.Bank, reg.Word, reg.ReadAddress, reg.WriteAddress),
+		fmt.Sprintf("Bits:     [%d:%d] len:%d", off+bitLen-1, off, bitLen),
+		fmt.Sprintf("Value:    %s", value),
+	} {
+		lines = append(lines, clip(line, 0, width))
+	}
+
+	if desc != "" {
+		lines = append(lines, clip("Info:     "+desc, 0, width))
+	}
+
+	lines = append(lines, "")
+
+	if !b.names {
+		if val, err := b.read(reg.Name); err == nil {
+			res = val
+		}
+	}
+
+	for _, line := range strings.Split(strings.TrimRight(reg.BitMap(res), "\n"), "\n") {
+		s := clip(line, b.shift, width)
+
+		if name != reg.Name && strings.HasSuffix(line, " "+name) {
+			s = reverse + s + normal
+		}
+
+		lines = append(lines, s)
+	}
+
+	return
+}
+
+func (b *browser) draw() {
+	var buf bytes.Buffer
+
+	columns, lines := b.size()
+	rows := b.rows()
+
+	// list width, the last column is left empty to prevent scrolling
+	width := 0
+
+	for _, reg := range b.regs {
+		width = max(width, len(reg.Name)+2)
+	}
+
+	width = min(width, columns/3)
+
+	// keep the selected register within the list
+	if b.reg < b.top {
+		b.top = b.reg
+	}
+
+	if b.reg >= b.top+rows {
+		b.top = b.reg - rows + 1
+	}
+
+	pane := b.details(columns - width - 2)
+	title := fmt.Sprintf(" crucible - %s ref:%s base:%d %s-endian", b.FuseMap.Processor, b.FuseMap.Reference, b.base(), b.endianness())
+
+	at := func(line int, s string) {
+		_, _ = fmt.Fprintf(&buf, "\x1b[%d;1H%s", line, s)
+	}
+
+	buf.WriteString(clearScreen)
+	at(1, reverse+pad(title, columns-1)+normal)
+
+	for i := 0; i < rows; i++ {
+		line := pad("", width)
+
+		if n := b.top + i; n < len(b.regs) {
+			line = pad(" "+b.regs[n].Name, width)
+
+			if n == b.reg {
+				line = reverse + line + normal
+			}
+		}
+
+		line += "│"
+
+		if i < len(pane) {
+			line += pane[i]
+		}
+
+		at(i+2, line)
+	}
+
+	at(lines-1, pad(b.status, columns-1))
+	at(lines, reverse+pad(" "+browseHelp, columns-1)+normal)
+
+	_, _ = b.w.Write(buf.Bytes())
+}
+
+// show selects a search result.
+func (b *browser) show(m *fusemap.Match) {
+	reg := m.Register
+
+	if m.Fuse != nil {
+		reg = m.Fuse.Register
+	}
+
+	for i, r := range b.regs {
+		if r == reg {
+			b.reg = i
+		}
+	}
+
+	b.fuse = -1
+
+	for i, fuse := range reg.FusesByOffset() {
+		if fuse == m.Fuse {
+			b.fuse = i
+		}
+	}
+
+	b.status = fmt.Sprintf("match %d/%d: %s", b.match+1, len(b.matches), m.Name())
+}
+
+// search prompts for a name pattern (see path.Match), matched as substring
+// when not containing any wildcard, or a read/write address (0x prefixed).
+func (b *browser) search() {
+	pattern, err := b.prompt("search (name pattern or 0x address): ")
+
+	if err != nil || pattern == "" {
+		return
+	}
+
+	q := &fusemap.Query{}
+
+	switch {
+	case strings.HasPrefix(pattern, "0x"):
+		addr, err := strconv.ParseUint(pattern, 0, 32)
+
+		if err != nil {
+			b.status = "error: invalid address"
+			return
+		}
+
+		q.Address = new(uint32)
+		*q.Address = uint32(addr)
+	case strings.ContainsAny(pattern, "*?["):
+		q.Name = pattern
+	default:
+		q.Name = "*" + pattern + "*"
+	}
+
+	matches, err := b.FuseMap.Search(q)
+
+	if err != nil {
+		b.status = "error: " + err.Error()
+		return
+	}
+
+	if len(matches) == 0 {
+		b.status = "no fuse/register matching " + pattern
+		return
+	}
+
+	b.matches = matches
+	b.match = 0
+	b.show(matches[0])
+}
+
+// next selects the next, or previous, search result.
+func (b *browser) next(dir int) {
+	n := len(b.matches)
+
+	if n == 0 {
+		b.status = "no search results"
+		return
+	}
+
+	b.match = (b.match + dir + n) % n
+	b.show(b.matches[b.match])
+}
+
+// blow prompts for a value to blow on the selected register or fuse, followed
+// by the blow command warning and confirmation.
+func (b *browser) blow() {
+	if b.Blow == nil {
+		b.status = "error: blow operation not supported"
+		return
+	}
+
+	_, name, _, _, _ := b.selected()
+	val, err := b.prompt(fmt.Sprintf("blow %s value (base %d, %s-endian): ", name, b.base(), b.endianness()))
+
+	if err != nil || val == "" {
+		b.status = "blow cancelled"
+		return
+	}
+
+	_, _ = fmt.Fprint(b.w, clearScreen+showCursor)
+
+	if err = b.Shell.blow(b.input, b.w, name, val); err != nil {
+		b.status = "error: " + err.Error()
+		_, _ = fmt.Fprintf(b.w, "error: %v\n", err)
+	} else {
+		b.status = fmt.Sprintf("otp:%s val:%s result:blown", name, val)
+	}
+
+	_, _ = fmt.Fprint(b.w, "\nPress any key to continue")
+	_, _ = b.r.ReadByte()
+	_, _ = fmt.Fprint(b.w, hideCursor)
+
+	// values might have changed
+	b.values = make(map[string][]byte)
+	b.errs = make(map[string]error)
+}
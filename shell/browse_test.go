@@ -0,0 +1,110 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package shell
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/usbarmory/crucible/otp"
+)
+
+func TestBrowse(t *testing.T) {
+	s, blown := testShell(t)
+
+	var out bytes.Buffer
+
+	// move down twice, search MAC1_ADDR, move across fuses, show names,
+	// search address 0x64 and select its second result
+	keys := "j\x1b[B/mac1_\r\x1b[C\x1b[Dv/0x64\rnq"
+
+	if err := s.Browse(&terminal{strings.NewReader(keys), &out}); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{
+		"crucible - IMX6UL ref:1 base:16 big-endian",
+		"Name:     OCOTP_LOCK",
+		"Name:     MAC1_ADDR",
+		"Register: OCOTP_MAC0 bank:4 word:2 R:0x88 W:0x88",
+		"Bits:     [47:0] len:48",
+		"Value:    0x001f7b1007e3",
+		"match 1/3: MAC1_ADDR",
+		"Name:     SRK_HASH",
+		"match 1/3: OCOTP_SRK1",
+		"match 2/3: SRK_HASH",
+		"Info:     super root key (SRK) table hash, secure boot",
+	} {
+		if !strings.Contains(out.String(), exp) {
+			t.Errorf("missing output %q", exp)
+		}
+	}
+
+	if len(blown) != 0 {
+		t.Error("browse should not fuse")
+	}
+}
+
+func TestBrowseBlow(t *testing.T) {
+	s, blown := testShell(t)
+
+	var out bytes.Buffer
+
+	// cancelled value, refused confirmation and confirmed blow
+	keys := "/MAC1_ADDR\rb\rb0x001f7b1007e3\rno\r bq\x7f0x001f7b1007e3\rYES\r q"
+
+	if err := s.Browse(&terminal{strings.NewReader(keys), &out}); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []byte{0x1f, 0x7b, 0x10, 0x07, 0xe3}; !bytes.Equal(blown["MAC1_ADDR"], exp) {
+		t.Errorf("unexpected blown value, %x != %x", blown["MAC1_ADDR"], exp)
+	}
+
+	for _, exp := range []string{
+		"blow cancelled",
+		"error: you are not ready",
+		otp.Warning,
+		"otp:MAC1_ADDR val:0x001f7b1007e3 result:blown",
+	} {
+		if !strings.Contains(out.String(), exp) {
+			t.Errorf("missing output %q", exp)
+		}
+	}
+
+	s.Blow = nil
+	out.Reset()
+
+	if err := s.Browse(&terminal{strings.NewReader("bq"), &out}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "error: blow operation not supported") {
+		t.Error("blow should not be supported")
+	}
+}
+
+func TestShellBrowse(t *testing.T) {
+	s, _ := testShell(t)
+
+	var out bytes.Buffer
+
+	if err := s.Run(&terminal{strings.NewReader("browse\nqexit\n"), &out}); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "Name:     OCOTP_LOCK") {
+		t.Errorf("unexpected browse output\n%s", out.String())
+	}
+
+	if strings.Contains(out.String(), "error:") {
+		t.Errorf("unexpected error output\n%s", out.String())
+	}
+}
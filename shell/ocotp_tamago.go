@@ -0,0 +1,32 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+//go:build tamago && (arm || arm64)
+
+package shell
+
+import (
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/otp"
+	"github.com/usbarmory/tamago/soc/nxp/ocotp"
+)
+
+// NewOCOTP returns a Shell instance operating on the NXP On-Chip OTP
+// Controller, see otp.Read() and otp.Blow().
+func NewOCOTP(ctrl *ocotp.OCOTP, f *fusemap.FuseMap) *Shell {
+	return &Shell{
+		FuseMap: f,
+		Read: func(name string) ([]byte, error) {
+			return otp.Read(ctrl, f, name)
+		},
+		Blow: func(name string, val []byte) (err error) {
+			_, err = otp.Blow(ctrl, f, name, val)
+			return
+		},
+	}
+}
@@ -0,0 +1,442 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+// Package shell implements an interactive command handler for
+// One-Time-Programmable (OTP) fuses read and write operations, suitable for
+// provisioning firmware operating on a serial console.
+//
+// The command set mirrors the crucible utility, with the same confirmation,
+// base and endianness semantics, including its full-screen fusemap browser
+// (see Browse()).
+//
+// WARNING: Fusing SoC OTPs is an **irreversible** action that permanently
+// fuses values on the device. This means that any errors in the process, or
+// lost fused data such as cryptographic key material, might result in a
+// **bricked** device.
+//
+// The use of this package is therefore **at your own risk**.
+package shell
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/usbarmory/crucible/fusemap"
+	"github.com/usbarmory/crucible/otp"
+	"github.com/usbarmory/crucible/util"
+)
+
+const help = `
+help                                 # this help
+list                                 # list registers and fuses
+browse                               # full-screen fusemap browser
+bitmap <register/fuse name>          # visualize read register value
+read   <register/fuse name>          # read register or fuse
+blow   <register/fuse name> <value>  # blow register or fuse
+base   [2|10|16]                     # show or set value base/format
+endian [big|little]                  # show or set value endianness
+exit                                 # exit shell
+`
+
+// Prompt is the shell command prompt.
+var Prompt = "crucible> "
+
+// Shell represents an interactive command handler for OTP fuses.
+type Shell struct {
+	// FuseMap is the fusemap used to resolve register and fuse names
+	FuseMap *fusemap.FuseMap
+
+	// Read reads a register or fuse, see otp.Read()
+	Read func(name string) (res []byte, err error)
+	// Blow fuses a register or fuse, see otp.Blow()
+	Blow func(name string, val []byte) (err error)
+
+	// Base is the value base/format (2, 10 or 16), 16 when not set
+	Base int
+	// Endianness is the value endianness (big or little), big when not
+	// set
+	Endianness string
+	// Force disables blow operation confirmation (DANGEROUS)
+	Force bool
+	// AllowCritical lists critical register/fuse names for which Force
+	// also disables the additional confirmation (DANGEROUS), see
+	// fusemap.FuseMap.Critical()
+	AllowCritical []string
+
+	// Columns is the terminal width for the browse command, 80 when not
+	// set
+	Columns int
+	// Lines is the terminal height for the browse command, 24 when not
+	// set
+	Lines int
+}
+
+func (s *Shell) base() int {
+	if s.Base == 0 {
+		return 16
+	}
+
+	return s.Base
+}
+
+func (s *Shell) endianness() string {
+	if s.Endianness == "" {
+		return "big"
+	}
+
+	return s.Endianness
+}
+
+// Run reads commands from the argument terminal until an exit command is
+// issued or the terminal is closed. Command lines are terminated by either
+// carriage return or line feed characters, line editing and echo are left to
+// the terminal.
+func (s *Shell) Run(term io.ReadWriter) (err error) {
+	r := newReader(term)
+
+	for {
+		_, _ = fmt.Fprint(term, Prompt)
+
+		line, err := readLine(r)
+
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		if line == "exit" || line == "quit" {
+			return nil
+		}
+
+		if err = s.exec(r, term, line); err != nil {
+			_, _ = fmt.Fprintf(term, "error: %v\n", err)
+		}
+	}
+}
+
+// Exec executes a single command line, any confirmation is read from the
+// argument terminal.
+func (s *Shell) Exec(term io.ReadWriter, line string) (err error) {
+	return s.exec(newReader(term), term, line)
+}
+
+// reader represents a terminal reader which skips the line feed of CRLF
+// sequences, also when received separately from the carriage return.
+type reader struct {
+	*bufio.Reader
+
+	// pending carriage return
+	cr bool
+}
+
+func newReader(term io.Reader) *reader {
+	return &reader{Reader: bufio.NewReader(term)}
+}
+
+// ReadByte reads a single byte, skipping a line feed which immediately
+// follows a carriage return.
+func (r *reader) ReadByte() (c byte, err error) {
+	c, err = r.Reader.ReadByte()
+
+	if err == nil && r.cr && c == '\n' {
+		c, err = r.Reader.ReadByte()
+	}
+
+	r.cr = err == nil && c == '\r'
+
+	return
+}
+
+func readLine(r *reader) (line string, err error) {
+	var buf []byte
+
+	for {
+		c, err := r.ReadByte()
+
+		if err == io.EOF && len(buf) > 0 {
+			break
+		}
+
+		if err != nil {
+			return "", err
+		}
+
+		if c == '\r' || c == '\n' {
+			break
+		}
+
+		buf = append(buf, c)
+	}
+
+	return strings.TrimSpace(string(buf)), nil
+}
+
+func (s *Shell) exec(r *reader, w io.Writer, line string) (err error) {
+	args := strings.Fields(line)
+
+	if len(args) == 0 {
+		return
+	}
+
+	if s.FuseMap == nil {
+		return errors.New("missing fusemap")
+	}
+
+	switch cmd := args[0]; cmd {
+	case "help":
+		_, _ = fmt.Fprint(w, help)
+	case "list":
+		s.list(w)
+	case "browse":
+		return s.browse(r, w)
+	case "bitmap", "read":
+		if len(args) != 2 {
+			return fmt.Errorf("usage: %s <register/fuse name>", cmd)
+		}
+
+		if cmd == "bitmap" {
+			return s.bitmap(w, args[1])
+		}
+
+		return s.read(w, args[1])
+	case "blow":
+		if len(args) != 3 {
+			return errors.New("usage: blow <register/fuse name> <value>")
+		}
+
+		return s.blow(func() (string, error) { return readLine(r) }, w, args[1], args[2])
+	case "base":
+		if len(args) == 2 {
+			base, _ := strconv.Atoi(args[1])
+
+			switch base {
+			case 2, 10, 16:
+				s.Base = base
+			default:
+				return errors.New("invalid base format")
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "base:%d\n", s.base())
+	case "endian":
+		if len(args) == 2 {
+			switch args[1] {
+			case "big", "little":
+				s.Endianness = args[1]
+			default:
+				return errors.New("invalid endianness")
+			}
+		}
+
+		_, _ = fmt.Fprintf(w, "endianness:%s\n", s.endianness())
+	default:
+		return fmt.Errorf("unknown command %s, type help for usage", cmd)
+	}
+
+	return
+}
+
+// params returns the register, offset and bit length of a register or fuse.
+func (s *Shell) params(name string) (reg *fusemap.Register, off int, bitLen int, err error) {
+	mapping, err := s.FuseMap.Find(name)
+
+	if err != nil {
+		return
+	}
+
+	switch m := mapping.(type) {
+	case *fusemap.Register:
+		reg = m
+		bitLen = reg.Length
+	case *fusemap.Fuse:
+		reg = m.Register
+		off = m.Offset
+		bitLen = m.Length
+	}
+
+	return
+}
+
+func (s *Shell) list(w io.Writer) {
+	t := tabwriter.NewWriter(w, 16, 8, 1, ' ', 0)
+
+	_, _ = fmt.Fprintf(t, "Register\tBank\tWord\tFuses\n")
+
+	for _, reg := range s.FuseMap.RegistersByWriteAddress() {
+		var fuses []string
+
+		for _, fuse := range reg.FusesByOffset() {
+			fuses = append(fuses, fmt.Sprintf("%s[%d:%d]", fuse.Name, fuse.Offset+fuse.Length-1, fuse.Offset))
+		}
+
+		_, _ = fmt.Fprintf(t, "%s\t%d\t%d\t%s\n", reg.Name, reg.Bank, reg.Word, strings.Join(fuses, " "))
+	}
+
+	_ = t.Flush()
+}
+
+func (s *Shell) bitmap(w io.Writer, name string) (err error) {
+	if s.Read == nil {
+		return errors.New("read operation not supported")
+	}
+
+	reg, _, _, err := s.params(name)
+
+	if err != nil {
+		return
+	}
+
+	res, err := s.Read(reg.Name)
+
+	if err != nil {
+		return
+	}
+
+	_, _ = fmt.Fprint(w, reg.BitMap(res))
+	_, _ = fmt.Fprintln(w)
+
+	return
+}
+
+func (s *Shell) format(res []byte, bitLen int) (prefix string, value string, err error) {
+	if s.endianness() == "little" {
+		res = util.SwitchEndianness(res)
+	}
+
+	n := new(big.Int)
+	n.SetBytes(res)
+
+	switch s.base() {
+	case 2:
+		prefix = "0b"
+		value = fmt.Sprintf("%0*b", bitLen, n)
+	case 10:
+		value = fmt.Sprintf("%d", n)
+	case 16:
+		prefix = "0x"
+		value = fmt.Sprintf("%0*x", (bitLen+3)/4, n)
+	default:
+		err = errors.New("invalid base format")
+	}
+
+	return
+}
+
+func (s *Shell) read(w io.Writer, name string) (err error) {
+	if s.Read == nil {
+		return errors.New("read operation not supported")
+	}
+
+	reg, off, bitLen, err := s.params(name)
+
+	if err != nil {
+		return
+	}
+
+	res, err := s.Read(name)
+
+	if err != nil {
+		return
+	}
+
+	prefix, value, err := s.format(res, bitLen)
+
+	if err != nil {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "otp:%s bank:%d word:%d off:%d len:%d val:%s%s\n", name, reg.Bank, reg.Word, off, bitLen, prefix, value)
+
+	return
+}
+
+func (s *Shell) blow(input func() (string, error), w io.Writer, name string, val string) (err error) {
+	if s.Blow == nil {
+		return errors.New("blow operation not supported")
+	}
+
+	if _, _, _, err = s.params(name); err != nil {
+		return
+	}
+
+	n, err := util.ParseValue(val, s.base(), s.endianness())
+
+	if err != nil {
+		return errors.New("invalid value argument")
+	}
+
+	if !s.Force {
+		_, _ = fmt.Fprint(w, otp.Warning)
+		_, _ = fmt.Fprintf(w, "otp:%s base:%d val:%s %s-endian\n\n", name, s.base(), val, s.endianness())
+		_, _ = fmt.Fprint(w, "Would you really like to blow this fuse? Type YES all uppercase to confirm: ")
+
+		if text, _ := input(); text != "YES" {
+			return errors.New("you are not ready")
+		}
+	}
+
+	if err = s.confirmCritical(input, w, name, n); err != nil {
+		return
+	}
+
+	if err = s.Blow(name, n); err != nil {
+		return
+	}
+
+	_, _ = fmt.Fprintf(w, "otp:%s val:%s result:blown\n", name, val)
+
+	return
+}
+
+// allowed returns whether all critical names are listed as allowed.
+func allowed(critical []string, allow []string) bool {
+	for _, name := range critical {
+		if !slices.Contains(allow, name) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// confirmCritical requires an additional confirmation, repeating name and
+// value, before fusing critical registers or fuses. Force applies only when
+// all involved critical names are listed in AllowCritical.
+func (s *Shell) confirmCritical(input func() (string, error), w io.Writer, name string, val []byte) (err error) {
+	critical, err := s.FuseMap.Critical(name)
+
+	if err != nil || len(critical) == 0 {
+		return
+	}
+
+	if s.Force && allowed(critical, s.AllowCritical) {
+		return
+	}
+
+	confirmation := otp.CriticalConfirmation(name, val)
+
+	_, _ = fmt.Fprint(w, otp.CriticalWarning)
+	_, _ = fmt.Fprintf(w, "otp:%s critical:%s\n\n", name, strings.Join(critical, ","))
+	_, _ = fmt.Fprintf(w, "Type %q to confirm: ", confirmation)
+
+	if text, _ := input(); text != confirmation {
+		return errors.New("you are not ready")
+	}
+
+	return
+}
@@ -0,0 +1,198 @@
+// crucible
+// One-Time-Programmable (OTP) fusing tool
+//
+// Copyright (c) The crucible authors. All Rights Reserved.
+//
+// Use of this source code is governed by the license
+// that can be found in the LICENSE file.
+
+package shell
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/usbarmory/crucible/fusemaps"
+	"github.com/usbarmory/crucible/otp"
+)
+
+type terminal struct {
+	io.Reader
+	io.Writer
+}
+
+func testShell(t *testing.T) (s *Shell, blown map[string][]byte) {
+	f, err := fusemaps.Find("IMX6UL", "1")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nvmem, err := os.ReadFile("../test/nvmem.IMX6UL")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	snapshot := &otp.Snapshot{Words: nvmem}
+	blown = make(map[string][]byte)
+
+	s = &Shell{
+		FuseMap: f,
+		Read: func(name string) (res []byte, err error) {
+			res, _, _, _, err = snapshot.Read(f, name)
+			return
+		},
+		Blow: func(name string, val []byte) error {
+			blown[name] = val
+			return nil
+		},
+	}
+
+	return
+}
+
+func TestShellRead(t *testing.T) {
+	s, _ := testShell(t)
+
+	var out bytes.Buffer
+	term := &terminal{strings.NewReader("read MAC1_ADDR\r\nendian little\nread OCOTP_OTPMK0\nbase 10\nbitmap SRK_LOCK\nexit\n"), &out}
+
+	if err := s.Run(term); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, exp := range []string{
+		"otp:MAC1_ADDR bank:4 word:2 off:0 len:48 val:0x001f7b1007e3\n",
+		"endianness:little\n",
+		"otp:OCOTP_OTPMK0 bank:2 word:0 off:0 len:32 val:0xdabadaba\n",
+		"base:10\n",
+		"OCOTP_LOCK",
+	} {
+		if !strings.Contains(out.String(), exp) {
+			t.Errorf("missing output %q", exp)
+		}
+	}
+
+	if strings.Contains(out.String(), "error:") {
+		t.Errorf("unexpected error output\n%s", out.String())
+	}
+}
+
+func TestShellBlow(t *testing.T) {
+	s, blown := testShell(t)
+
+	var out bytes.Buffer
+
+	if err := s.Exec(&terminal{strings.NewReader("no\n"), &out}, "blow MAC1_ADDR 0x001f7b1007e3"); err == nil {
+		t.Error("blow without confirmation should raise an error")
+	}
+
+	if len(blown) != 0 {
+		t.Fatal("blow without confirmation should not fuse")
+	}
+
+	if err := s.Exec(&terminal{strings.NewReader("YES\n"), &out}, "blow MAC1_ADDR 0x001f7b1007e3"); err != nil {
+		t.Fatal(err)
+	}
+
+	if exp := []byte{0x1f, 0x7b, 0x10, 0x07, 0xe3}; !bytes.Equal(blown["MAC1_ADDR"], exp) {
+		t.Errorf("unexpected blown value, %x != %x", blown["MAC1_ADDR"], exp)
+	}
+
+	if !strings.Contains(out.String(), otp.Warning) {
+		t.Error("blow should display the warning")
+	}
+
+	for _, line := range []string{
+		"blow MAC1_ADDR",
+		"blow INVALID 0x01",
+		"blow MAC1_ADDR 0xzz",
+		"base 8",
+		"endian middle",
+		"invalid",
+	} {
+		if err := s.Exec(&terminal{strings.NewReader("YES\n"), &out}, line); err == nil {
+			t.Errorf("%q should raise an error", line)
+		}
+	}
+}
+
+func TestShellCRLF(t *testing.T) {
+	s, blown := testShell(t)
+
+	var out bytes.Buffer
+
+	// CRLF sequences delivered one byte at a time
+	input := iotest.OneByteReader(strings.NewReader("blow MAC1_ADDR 0x001f7b1007e3\r\nYES\r\n\r\nexit\r\n"))
+
+	if err := s.Run(&terminal{input, &out}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := blown["MAC1_ADDR"]; !ok || strings.Contains(out.String(), "error:") {
+		t.Errorf("split CRLF sequences should be handled as a single line terminator\n%s", out.String())
+	}
+}
+
+func TestShellList(t *testing.T) {
+	s, _ := testShell(t)
+
+	var out bytes.Buffer
+
+	if err := s.Exec(&terminal{strings.NewReader(""), &out}, "list"); err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(out.String(), "OCOTP_MAC0") || !strings.Contains(out.String(), "MAC1_ADDR[31:0]") {
+		t.Errorf("unexpected list output\n%s", out.String())
+	}
+}
+
+func TestShellBlowCritical(t *testing.T) {
+	s, blown := testShell(t)
+
+	var out bytes.Buffer
+
+	if err := s.Exec(&terminal{strings.NewReader("YES\nSEC_CONFIG 0x3\n"), &out}, "blow SEC_CONFIG 0x2"); err == nil {
+		t.Error("blow without critical confirmation should raise an error")
+	}
+
+	s.Force = true
+
+	if err := s.Exec(&terminal{strings.NewReader(""), &out}, "blow OCOTP_CFG5 0x2"); err == nil {
+		t.Error("forced blow without allowed critical fuses should raise an error")
+	}
+
+	if len(blown) != 0 {
+		t.Fatal("blow without critical confirmation should not fuse")
+	}
+
+	if !strings.Contains(out.String(), otp.CriticalWarning) || !strings.Contains(out.String(), "critical:SEC_CONFIG,DIR_BT_DIS,SJC_DISABLE,JTAG_SMODE") {
+		t.Errorf("blow should display critical fuses\n%s", out.String())
+	}
+
+	if err := s.Exec(&terminal{strings.NewReader("SEC_CONFIG 0x2\n"), &out}, "blow SEC_CONFIG 0x2"); err != nil {
+		t.Fatal(err)
+	}
+
+	s.AllowCritical = []string{"SEC_CONFIG", "DIR_BT_DIS", "SJC_DISABLE", "JTAG_SMODE"}
+
+	if err := s.Exec(&terminal{strings.NewReader(""), &out}, "blow OCOTP_CFG5 0x2"); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.Exec(&terminal{strings.NewReader(""), &out}, "blow GP1 0x2"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"SEC_CONFIG", "OCOTP_CFG5", "GP1"} {
+		if _, ok := blown[name]; !ok {
+			t.Errorf("%s should be blown", name)
+		}
+	}
+}
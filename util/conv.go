@@ -11,9 +11,11 @@
 package util
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"math/bits"
+	"strings"
 )
 
 // Pad4 pads a byte array to ensure that it always represents one or more
@@ -107,3 +109,36 @@ func ConvertWriteValue(off int, bitLen int, val []byte) (res []byte, err error)
 
 	return
 }
+
+// ParseValue converts a string value, expressed in the argument base (2, 10,
+// 16) and endianness (big, little), to a big-endian byte array. Binary and
+// hexadecimal values can be optionally prefixed with 0b and 0x respectively.
+func ParseValue(val string, base int, endianness string) (res []byte, err error) {
+	switch base {
+	case 2:
+		val = strings.TrimPrefix(val, "0b")
+	case 10:
+	case 16:
+		val = strings.TrimPrefix(val, "0x")
+	default:
+		return nil, errors.New("invalid base")
+	}
+
+	n, ok := new(big.Int).SetString(val, base)
+
+	if !ok || n.Sign() < 0 {
+		return nil, errors.New("invalid value")
+	}
+
+	res = n.Bytes()
+
+	switch endianness {
+	case "big":
+	case "little":
+		res = new(big.Int).SetBytes(SwitchEndianness(res)).Bytes()
+	default:
+		return nil, errors.New("invalid endianness")
+	}
+
+	return
+}